@@ -2,59 +2,302 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
+	"net/url"
 	"os"
+	"os/signal"
 	"oss/internal/config"
 	"oss/internal/crawler"
 	"oss/internal/models"
+	"oss/internal/pipeline"
 	"oss/internal/search"
 	"oss/internal/storage"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
 )
 
-type DualSaver struct {
-	PG *storage.DB
-	ES *search.Client
-}
+func main() {
+	cfg := config.LoadConfig()
+	sourceNames := flag.String("source", "", "Comma separated registered sources to crawl, every enabled source when empty")
+	inventories := flag.String("inventory", "", "Comma separated sphinx objects.inv urls or paths to load symbols from, besides those in the sources' settings")
+	inventoryBase := flag.String("inventory-base", "", "Url the inventories are published under, required for local files")
+	batchSize := flag.Int("batch", crawler.DefaultBatchSize, "Pages saved per transaction, 1 to save each page on its own")
+	deadLetters := flag.String("dead-letters", "dead_letters.jsonl", "File pages that fail to save are queued in, replay them with the retry command")
+	dryRun := flag.Bool("dry-run", false, "Print extracted pages to stdout instead of saving them")
+	single := flag.String("url", "", "With -dry-run, extract only this url or saved html file instead of crawling")
+	format := flag.String("format", "json", "Dry run output: json (one page per line) or tree")
+	seeds := flag.String("seed", "", "With -dry-run, comma separated urls to crawl instead of the registered sources, no database needed")
+	domains := flag.String("domains", "", "With -seed, comma separated hosts links may be followed to, the seeds' hosts when empty")
+	authFile := flag.String("auth", "", "Json file of per-domain credentials for private docs, secrets given as env:NAME or file:/path")
+	flag.Parse()
 
-func (ds *DualSaver) SavePage(ctx context.Context, p models.ScrapedPage) error {
-	if err := ds.PG.SavePage(ctx, p); err != nil {
-		return err
+	var auth []crawler.AuthConfig
+	if *authFile != "" {
+		var err error
+		if auth, err = crawler.LoadAuthConfig(*authFile); err != nil {
+			log.Fatalf("Failed to load auth config: %v", err)
+		}
 	}
-	if err := ds.ES.SavePage(ctx, p); err != nil {
-		log.Printf("Warning: Failed to index page %s: %v", p.URL, err)
+
+	if *dryRun {
+		runDry(cfg, *single, *format, *sourceNames, *seeds, *domains, auth)
+		return
+	}
+	if *single != "" {
+		log.Fatalf("-url is only supported with -dry-run")
+	}
+	if *seeds != "" || *domains != "" {
+		log.Fatalf("-seed and -domains are only supported with -dry-run")
 	}
-	return nil
-}
 
-func main() {
-	cfg := config.LoadConfig()
 	// elasticsearch shenanigans
 	es, _ := search.NewClient(cfg.ElasticsearchURL)
 	schema, _ := os.ReadFile("internal/search/schema.json")
 	es.InitIndex(context.Background(), schema)
 
-	// postgres db init
-	db, err := storage.NewDB(cfg.DatabaseURL)
+	// database init
+	db, err := storage.Open(cfg.DatabaseURL)
 	if err != nil {
 		log.Fatalf("Error connecting to database: %v\n", err)
 	}
+	if err := db.CheckSchema(context.Background()); err != nil {
+		log.Fatalf("Schema check failed: %v", err)
+	}
 	defer db.Close()
+	db.SetKeepVersions(cfg.KeepVersions)
+
+	saver := pipeline.DualSaver{
+		DB:         db,
+		ES:         es,
+		MinQuality: cfg.MinQuality,
+	}
+
+	sources := loadSources(db, *sourceNames)
+	for _, inv := range splitList(*inventories) {
+		loadInventory(db, inv, *inventoryBase)
+	}
+
+	queue := crawler.NewDeadLetterQueue(*deadLetters)
+	var current atomic.Pointer[crawler.Crawler]
+	interrupted := stopOnSignal(&current)
+	for _, source := range sources {
+		for _, inv := range source.Settings.Inventories {
+			loadInventory(db, inv, *inventoryBase)
+		}
+
+		c := crawler.NewCrawler(&saver)
+		c.DeadLetters = queue
+		c.BatchSize = *batchSize
+		if err := c.Authenticate(context.Background(), auth); err != nil {
+			log.Fatalf("Authentication failed: %v", err)
+		}
+		current.Store(c)
+		if interrupted() {
+			break
+		}
+
+		log.Printf("Beginning crawl of %s on urls %v...\n", source.Name, source.Seeds)
+		c.CrawlSource(source)
+		log.Printf("Stopping crawl...\n")
+
+		summary := c.Summary()
+		if c.Stopped() {
+			log.Printf("Crawl of %s interrupted", source.Name)
+		} else {
+			log.Printf("Crawl of %s complete", source.Name)
+		}
+		log.Printf("Saved:         %d", summary.Saved)
+		log.Printf("Skipped:       %d", summary.Skipped)
+		log.Printf("Failed:        %d", summary.Failed)
+		log.Printf("Dead-lettered: %d (%s)", summary.DeadLettered, *deadLetters)
+		log.Printf("Fetch errors:  %d", summary.FetchErrors)
+		for _, reason := range sortedReasons(summary.Errors) {
+			log.Printf("  %5d  %s", summary.Errors[reason], reason)
+		}
+		run := summary.CrawlRun(source.Name)
+		if err := db.SaveCrawlRun(context.Background(), &run); err != nil {
+			log.Printf("failed to save crawl run report: %v\n", err)
+			continue
+		}
+		log.Printf("Saved run report %d", run.ID)
+	}
+}
+
+// stopOnSignal stops the current crawl on ctrl-c or SIGTERM, so that its
+// buffered pages are saved and its run is recorded, and exits at once on a
+// second signal. interrupted reports whether a signal arrived.
+func stopOnSignal(current *atomic.Pointer[crawler.Crawler]) (interrupted func() bool) {
+	var got atomic.Bool
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("Received %v, finishing the pages being fetched...", sig)
+		got.Store(true)
+		if c := current.Load(); c != nil {
+			c.Stop()
+		}
+		<-signals
+		log.Printf("Exiting without saving buffered pages")
+		os.Exit(1)
+	}()
+	return got.Load
+}
+
+// loadSources reads the named sources from the registry, or every enabled
+// one when names is empty. Naming a disabled source is an error.
+func loadSources(db storage.Store, names string) []models.Source {
+	ctx := context.Background()
+	if names == "" {
+		sources, err := db.ListSources(ctx, true)
+		if err != nil {
+			log.Fatalf("Failed to load sources: %v", err)
+		}
+		if len(sources) == 0 {
+			log.Fatalf("No enabled sources to crawl, register one with POST /sources")
+		}
+		return sources
+	}
+
+	var sources []models.Source
+	for _, name := range splitList(names) {
+		source, err := db.GetSourceByName(ctx, name)
+		if err != nil {
+			log.Fatalf("Failed to load source %s: %v", name, err)
+		}
+		if source == nil {
+			log.Fatalf("No source named %s", name)
+		}
+		if !source.Enabled {
+			log.Fatalf("Source %s is disabled", name)
+		}
+		sources = append(sources, *source)
+	}
+	return sources
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// sortedReasons orders failure reasons by how often they occurred.
+func sortedReasons(errs map[string]int) []string {
+	reasons := make([]string, 0, len(errs))
+	for r := range errs {
+		reasons = append(reasons, r)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if errs[reasons[i]] != errs[reasons[j]] {
+			return errs[reasons[i]] > errs[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	return reasons
+}
 
-	saver := DualSaver{
-		PG: db,
-		ES: es,
+// runDry crawls as usual, or extracts just the page at location, and prints
+// the pages instead of saving them. Nothing is written to the database or
+// elasticsearch. Crawls start from seeds when given, otherwise they read the
+// source registry.
+func runDry(cfg *config.Config, location, format, sourceNames, seeds, domains string, auth []crawler.AuthConfig) {
+	out, err := crawler.NewPrintSaver(os.Stdout, format)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	crawler := crawler.NewCrawler(&saver)
+	if location != "" {
+		c := crawler.NewCrawler(out)
+		if err := c.Authenticate(context.Background(), auth); err != nil {
+			log.Fatalf("Authentication failed: %v", err)
+		}
+		page, err := c.ExtractLocation(context.Background(), location)
+		if err != nil {
+			log.Fatalf("Extraction failed: %v", err)
+		}
+		if err := out.SavePage(context.Background(), page); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	domains := []string{"pytorch.org", "docs.pytorch.org"}
-	startURLs := []string{
-		"https://pytorch.org/docs/stable/index.html",
+	var sources []models.Source
+	if seeds != "" {
+		sources = []models.Source{seedSource(seeds, domains)}
+	} else {
+		db, err := storage.Open(cfg.DatabaseURL)
+		if err != nil {
+			log.Fatalf("Error connecting to database: %v\n", err)
+		}
+		if err := db.CheckSchema(context.Background()); err != nil {
+			log.Fatalf("Schema check failed: %v", err)
+		}
+		sources = loadSources(db, sourceNames)
+		db.Close()
 	}
-	log.Printf("Beginning crawl on urls %v...\n", startURLs)
 
-	crawler.Collector.AllowedDomains = domains
+	for _, source := range sources {
+		log.Printf("Beginning dry run crawl of %s on urls %v...\n", source.Name, source.Seeds)
+		c := crawler.NewCrawler(out)
+		if err := c.Authenticate(context.Background(), auth); err != nil {
+			log.Fatalf("Authentication failed: %v", err)
+		}
+		c.CrawlSource(source)
 
-	crawler.Crawl(domains, startURLs)
-	log.Printf("Stopping crawl...\n")
+		summary := c.Summary()
+		log.Printf("Dry run of %s complete", source.Name)
+		log.Printf("Extracted:    %d", summary.Saved)
+		log.Printf("Skipped:      %d", summary.Skipped)
+		log.Printf("Fetch errors: %d", summary.FetchErrors)
+	}
+}
+
+// seedSource is an unregistered source for a dry run of seeds, following
+// links to domains or else to the seeds' hosts.
+func seedSource(seeds, domains string) models.Source {
+	source := models.Source{
+		Name:    "seeds",
+		Seeds:   splitList(seeds),
+		Domains: splitList(domains),
+		Enabled: true,
+	}
+	if len(source.Domains) == 0 {
+		for _, seed := range source.Seeds {
+			u, err := url.Parse(seed)
+			if err != nil {
+				log.Fatalf("Invalid seed %s: %v", seed, err)
+			}
+			if host := strings.ToLower(u.Hostname()); !slices.Contains(source.Domains, host) {
+				source.Domains = append(source.Domains, host)
+			}
+		}
+	}
+	if err := source.Validate(); err != nil {
+		log.Fatalf("Invalid -seed or -domains: %v", err)
+	}
+	return source
+}
+
+// symbols are best effort, a missing inventory shouldn't stop the crawl
+func loadInventory(db storage.Store, location, base string) {
+	ctx := context.Background()
+	symbols, err := crawler.LoadInventory(ctx, location, base)
+	if err != nil {
+		log.Printf("failed to load inventory %s: %v\n", location, err)
+		return
+	}
+	if err := db.SaveSymbols(ctx, symbols); err != nil {
+		log.Printf("failed to save symbols from %s: %v\n", location, err)
+		return
+	}
+	log.Printf("saved %d symbols from %s\n", len(symbols), location)
 }
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"oss/internal/config"
+	"oss/internal/ingest"
+	"oss/internal/pipeline"
+	"oss/internal/search"
+	"oss/internal/storage"
+)
+
+const usage = `usage: ingest <command> [flags]
+
+commands:
+  docs       import markdown, reStructuredText and html files from a directory
+  notebooks  import jupyter notebooks from a directory
+  godoc      import go package documentation from a module directory
+  openapi    import OpenAPI 3 documents, one page per operation
+  man        import troff man pages, stored under man: urls
+  docset     import a Dash/Zeal docset's html and symbol index
+  qa         import questions and accepted answers from a Stack Exchange Posts.xml
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cmd, args := os.Args[1], os.Args[2:]
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+
+	var src ingest.Source
+	switch cmd {
+	case "docs":
+		dir := fs.String("dir", ".", "Directory to walk for documentation files")
+		base := fs.String("base", "", "Base url the directory is published under (default file:// paths)")
+		fs.Parse(args)
+		src = &ingest.DirSource{Root: *dir, BaseURL: *base}
+	case "notebooks":
+		dir := fs.String("dir", ".", "Directory to walk for .ipynb files")
+		base := fs.String("base", "", "Base url the notebooks are published under (default file:// paths)")
+		outputs := fs.Bool("outputs", false, "Include text outputs of code cells")
+		fs.Parse(args)
+		src = &ingest.NotebookSource{Root: *dir, BaseURL: *base, IncludeOutputs: *outputs}
+	case "godoc":
+		dir := fs.String("dir", ".", "Module root, a checkout or a directory in the module cache")
+		base := fs.String("base", "https://pkg.go.dev", "Base url package import paths are joined onto")
+		module := fs.String("module", "", "Module path (default read from go.mod)")
+		fs.Parse(args)
+		src = &ingest.GoSource{Root: *dir, BaseURL: *base, ModulePath: *module}
+	case "openapi":
+		dir := fs.String("dir", ".", "Directory to walk for OpenAPI json/yaml files")
+		base := fs.String("base", "", "Base url the specs are published under (default file:// paths)")
+		fs.Parse(args)
+		src = &ingest.OpenAPISource{Root: *dir, BaseURL: *base}
+	case "man":
+		dir := fs.String("dir", "/usr/share/man", "Man page root containing man1, man3, ... directories")
+		fs.Parse(args)
+		src = &ingest.ManSource{Root: *dir}
+	case "docset":
+		dir := fs.String("dir", "", "Path to the .docset bundle")
+		base := fs.String("base", "", "Url the docset's Documents directory is published under (default file:// paths)")
+		fs.Parse(args)
+		src = &ingest.DocsetSource{Root: *dir, BaseURL: *base}
+	case "qa":
+		path := fs.String("posts", "Posts.xml", "Path to the dump's Posts.xml")
+		site := fs.String("site", "https://stackoverflow.com", "Site the dump was taken from")
+		minScore := fs.Int("min-score", 0, "Skip questions scored below this")
+		all := fs.Bool("unanswered", false, "Also import questions without an accepted answer")
+		fs.Parse(args)
+		src = &ingest.StackExchangeSource{Path: *path, SiteURL: *site, MinScore: *minScore, IncludeUnanswered: *all}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg := config.LoadConfig()
+	saver, closeSaver := newSaver(cfg)
+	defer closeSaver()
+
+	// ctrl-c stops the walk, pages already read are still saved
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Ingesting %s...\n", cmd)
+	stats, err := ingest.Run(ctx, src, saver)
+	if err != nil {
+		log.Fatalf("Ingest failed: %v", err)
+	}
+	log.Printf("Ingest complete")
+	log.Printf("Pages:   %d", stats.Pages)
+	log.Printf("Saved:   %d", stats.Saved)
+	log.Printf("Skipped: %d", stats.Skipped)
+	log.Printf("Symbols: %d", stats.Symbols)
+	log.Printf("Errors:  %d", stats.Failed)
+}
+
+func newSaver(cfg *config.Config) (*pipeline.DualSaver, func()) {
+	es, err := search.NewClient(cfg.ElasticsearchURL)
+	if err != nil {
+		log.Fatalf("ES Error: %v", err)
+	}
+	schema, _ := os.ReadFile("internal/search/schema.json")
+	es.InitIndex(context.Background(), schema)
+
+	db, err := storage.Open(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("DB Error: %v", err)
+	}
+	if err := db.CheckSchema(context.Background()); err != nil {
+		log.Fatalf("Schema check failed: %v", err)
+	}
+	db.SetKeepVersions(cfg.KeepVersions)
+	return &pipeline.DualSaver{DB: db, ES: es, MinQuality: cfg.MinQuality}, db.Close
+}
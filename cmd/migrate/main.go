@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"oss/internal/config"
+	"oss/internal/storage"
+)
+
+const usage = `usage: migrate <command> [flags]
+
+commands:
+  up       apply pending migrations
+  down     revert the latest migrations
+  status   list migrations and whether they're applied
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cfg := config.LoadConfig()
+	db, err := storage.Open(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("DB Error: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	cmd, args := os.Args[1], os.Args[2:]
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	switch cmd {
+	case "up":
+		to := fs.Int("to", 0, "Stop after this version, 0 applies all")
+		wait := fs.Duration("wait", 0, "How long to wait for the database to come up")
+		fs.Parse(args)
+		waitForDB(ctx, db, *wait)
+		done, err := db.Migrate(ctx, *to)
+		for _, m := range done {
+			log.Printf("Applied %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(done) == 0 {
+			log.Println("Schema is up to date")
+		}
+	case "down":
+		steps := fs.Int("steps", 1, "Number of migrations to revert")
+		fs.Parse(args)
+		done, err := db.Rollback(ctx, *steps)
+		for _, m := range done {
+			log.Printf("Reverted %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Rollback failed: %v", err)
+		}
+	case "status":
+		fs.Parse(args)
+		status, err := db.MigrationStatus(ctx)
+		if err != nil {
+			log.Fatalf("Failed to read migrations: %v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		w.Flush()
+		if err := db.CheckSchema(ctx); err != nil {
+			fmt.Println()
+			fmt.Println(err)
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// waitForDB retries connecting until the database answers or the wait is
+// over, for containers that start alongside it.
+func waitForDB(ctx context.Context, db storage.Store, wait time.Duration) {
+	deadline := time.Now().Add(wait)
+	for {
+		err := db.Ping(ctx)
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			log.Fatalf("Database unreachable: %v", err)
+		}
+		time.Sleep(time.Second)
+	}
+}
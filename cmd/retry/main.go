@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"oss/internal/config"
+	"oss/internal/crawler"
+	"oss/internal/pipeline"
+	"oss/internal/search"
+	"oss/internal/storage"
+)
+
+// retry replays the pages a crawl failed to save from its dead-letter queue.
+func main() {
+	cfg := config.LoadConfig()
+	file := flag.String("dead-letters", "dead_letters.jsonl", "Dead-letter queue written by the crawler")
+	maxAttempts := flag.Int("max-attempts", 5, "Leave pages that have failed this many times in the queue, 0 for no limit")
+	flag.Parse()
+
+	queue := crawler.NewDeadLetterQueue(*file)
+	letters, err := queue.Load()
+	if err != nil {
+		log.Fatalf("Failed to read dead letters: %v", err)
+	}
+	if len(letters) == 0 {
+		log.Printf("No dead letters in %s", *file)
+		return
+	}
+
+	es, err := search.NewClient(cfg.ElasticsearchURL)
+	if err != nil {
+		log.Fatalf("ES Error: %v", err)
+	}
+	schema, _ := os.ReadFile("internal/search/schema.json")
+	es.InitIndex(context.Background(), schema)
+
+	db, err := storage.Open(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("DB Error: %v", err)
+	}
+	if err := db.CheckSchema(context.Background()); err != nil {
+		log.Fatalf("Schema check failed: %v", err)
+	}
+	defer db.Close()
+	db.SetKeepVersions(cfg.KeepVersions)
+
+	saver := &pipeline.DualSaver{DB: db, ES: es, MinQuality: cfg.MinQuality}
+
+	log.Printf("Retrying %d dead letters from %s...", len(letters), *file)
+	stats, err := queue.Retry(context.Background(), saver, *maxAttempts)
+	if err != nil {
+		log.Fatalf("Retry failed: %v", err)
+	}
+	log.Printf("Retry complete")
+	log.Printf("Retried: %d", stats.Retried)
+	log.Printf("Saved:   %d", stats.Saved)
+	log.Printf("Failed:  %d", stats.Failed)
+	log.Printf("Gave up: %d (reached %d attempts)", stats.GaveUp, *maxAttempts)
+}
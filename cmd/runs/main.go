@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"oss/internal/config"
+	"oss/internal/models"
+	"oss/internal/storage"
+)
+
+const usage = `usage: runs <command> [flags]
+
+commands:
+  list              list recent crawl runs
+  show <id>         print one run in full
+  compare <a> <b>   show what changed from run a to run b
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cfg := config.LoadConfig()
+	db, err := storage.Open(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("DB Error: %v", err)
+	}
+	if err := db.CheckSchema(context.Background()); err != nil {
+		log.Fatalf("Schema check failed: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	cmd, args := os.Args[1], os.Args[2:]
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	switch cmd {
+	case "list":
+		source := fs.String("source", "", "Only list runs of this source")
+		limit := fs.Int("limit", 20, "Number of runs to list")
+		fs.Parse(args)
+		runs, err := db.ListCrawlRuns(ctx, *source, *limit)
+		if err != nil {
+			log.Fatalf("Failed to list runs: %v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSOURCE\tSTARTED\tDURATION\tFETCHED\tSAVED\tSKIPPED\tFAILED\tBYTES")
+		for _, r := range runs {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\n",
+				r.ID, r.Source, r.StartedAt.Format(time.DateTime), r.Duration().Round(time.Second),
+				r.Fetched, r.Saved, r.Skipped, r.Failed, r.Bytes)
+		}
+		w.Flush()
+	case "show":
+		fs.Parse(args)
+		run := loadRun(ctx, db, fs.Arg(0))
+		printRun(run)
+	case "compare":
+		fs.Parse(args)
+		if fs.NArg() != 2 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		base, head := loadRun(ctx, db, fs.Arg(0)), loadRun(ctx, db, fs.Arg(1))
+		printDiff(models.CompareRuns(base, head))
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func loadRun(ctx context.Context, db storage.Store, arg string) *models.CrawlRun {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		log.Fatalf("Invalid run id %q", arg)
+	}
+	run, err := db.GetCrawlRun(ctx, id)
+	if err != nil {
+		log.Fatalf("Failed to load run %d: %v", id, err)
+	}
+	if run == nil {
+		log.Fatalf("No run with id %d", id)
+	}
+	return run
+}
+
+func printRun(r *models.CrawlRun) {
+	fmt.Printf("Run %d (%s)\n", r.ID, r.Source)
+	fmt.Printf("Started:  %s\n", r.StartedAt.Format(time.DateTime))
+	fmt.Printf("Duration: %s\n", r.Duration().Round(time.Second))
+	fmt.Printf("Fetched:  %d (%d bytes)\n", r.Fetched, r.Bytes)
+	fmt.Printf("Saved:    %d\n", r.Saved)
+	fmt.Printf("Skipped:  %d\n", r.Skipped)
+	fmt.Printf("Failed:   %d\n", r.Failed)
+
+	fmt.Println("\nStatuses:")
+	for _, code := range sortedKeys(r.Statuses) {
+		fmt.Printf("  %d  %d\n", code, r.Statuses[code])
+	}
+	fmt.Println("\nErrors:")
+	for _, typ := range sortedKeys(r.Errors) {
+		fmt.Printf("  %-12s %d\n", typ, r.Errors[typ])
+	}
+	fmt.Println("\nSlowest urls:")
+	for _, t := range r.SlowURLs {
+		fmt.Printf("  %6dms  %s\n", t.Duration, t.URL)
+	}
+}
+
+func printDiff(d models.RunDiff) {
+	fmt.Printf("Run %d -> %d\n", d.Base.ID, d.Head.ID)
+	fmt.Printf("Duration: %+dms\n", d.Duration)
+	fmt.Printf("Fetched:  %+d\n", d.Fetched)
+	fmt.Printf("Saved:    %+d\n", d.Saved)
+	fmt.Printf("Skipped:  %+d\n", d.Skipped)
+	fmt.Printf("Failed:   %+d\n", d.Failed)
+	fmt.Printf("Bytes:    %+d\n", d.Bytes)
+
+	if len(d.Statuses) > 0 {
+		fmt.Println("\nStatuses:")
+		for _, code := range sortedKeys(d.Statuses) {
+			fmt.Printf("  %d  %+d\n", code, d.Statuses[code])
+		}
+	}
+	if len(d.Errors) > 0 {
+		fmt.Println("\nErrors:")
+		for _, typ := range sortedKeys(d.Errors) {
+			fmt.Printf("  %-12s %+d\n", typ, d.Errors[typ])
+		}
+	}
+}
+
+func sortedKeys[K int | string](m map[K]int) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"log"
 	"oss/internal/api"
 	"oss/internal/config"
 	"oss/internal/search"
+	"oss/internal/storage"
+	"oss/internal/watch"
 	pb "oss/pb"
 	"time"
 
@@ -23,7 +26,7 @@ func main() {
 		if err == nil {
 			break
 		}
-		log.Printf("Waiting for DB, attempt %d", (i+1))
+		log.Printf("Waiting for DB, attempt %d", (i + 1))
 		time.Sleep(5 * time.Second)
 	}
 	MLClient := pb.NewMLServiceClient(pyML)
@@ -35,11 +38,29 @@ func main() {
 		log.Fatalf("elasticsearch could not connect %v", err)
 	}
 
+	// connect to the database
+	db, err := storage.Open(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("database could not connect %v", err)
+	}
+	if err := db.CheckSchema(context.Background()); err != nil {
+		log.Fatalf("Schema check failed: %v", err)
+	}
+	defer db.Close()
+
 	svc := &api.SearchService{
 		ESClient: es,
 		MLClient: MLClient,
+		Fallback: &search.Database{Store: db, MinQuality: cfg.MinQuality},
+		Timeout:  cfg.SearchTimeout,
 	}
-	handler := &api.Handler{Service: svc}
+	handler := &api.Handler{Service: svc, DB: db, NotifyTokens: cfg.NotifyTokens, UserTokens: cfg.UserTokens}
+
+	// deliver watch events to webhooks in the background
+	notifier := watch.NewNotifier(db)
+	notifierCtx, stopNotifier := context.WithCancel(context.Background())
+	defer stopNotifier()
+	go notifier.Run(notifierCtx)
 
 	r := gin.Default()
 
@@ -49,6 +70,24 @@ func main() {
 	})
 
 	r.GET("search", handler.HandleSearch)
+	r.GET("symbols", handler.HandleSymbols)
+	r.GET("page", handler.HandlePage)
+	r.GET("page/versions", handler.HandleVersions)
+	r.GET("page/diff", handler.HandleDiff)
+	r.GET("runs", handler.HandleRuns)
+	r.GET("runs/compare", handler.HandleCompareRuns)
+	r.GET("workers", handler.HandleWorkers)
+	r.POST("notify", handler.HandleNotify)
+	r.POST("watches", handler.HandleCreateWatch)
+	r.GET("watches", handler.HandleWatches)
+	r.DELETE("watches/:id", handler.HandleDeleteWatch)
+	r.GET("feed", handler.HandleFeed)
+	r.GET("sources", handler.HandleSources)
+	r.POST("sources", handler.HandleCreateSource)
+	r.GET("sources/:id", handler.HandleSource)
+	r.PUT("sources/:id", handler.HandleUpdateSource)
+	r.POST("sources/:id/disable", handler.HandleDisableSource)
+	r.POST("sources/:id/enable", handler.HandleEnableSource)
 
 	log.Printf("server running on port %s\n", cfg.Port)
 	err = r.Run(":" + cfg.Port)
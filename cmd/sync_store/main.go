@@ -6,32 +6,49 @@ import (
 	"encoding/json"
 	"flag"
 	"log"
+	"net/http"
 	"os"
-	"strings"
 	"sync/atomic"
 	"time"
 
 	"oss/internal/config"
 	"oss/internal/models"
+	"oss/internal/quality"
+	"oss/internal/search"
 	"oss/internal/storage"
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esutil"
 )
 
+// checkpointName is the sync_checkpoints row of the elasticsearch sync
+const checkpointName = "elasticsearch"
+
+// checkpointOverlap is subtracted from a sync's start time when saving the
+// checkpoint, so pages saved by transactions still open when it started are
+// picked up by the next sync.
+const checkpointOverlap = time.Minute
+
 func main() {
 	cfg := config.LoadConfig()
 	// allow option to reset index (--reset)
-	resetIndex := flag.Bool("reset", false, "Delete and recreate elasticsearch index")
+	resetIndex := flag.Bool("reset", false, "Delete and recreate elasticsearch index, implies -full")
+	full := flag.Bool("full", false, "Sync every page instead of those changed since the last sync")
+	since := flag.String("since", "", "Sync pages changed after this RFC 3339 time instead of the last checkpoint")
+	source := flag.String("source", "", "Only sync pages of this registered source or kind, e.g. web")
+	prefix := flag.String("url-prefix", "", "Only sync pages whose url starts with this")
 	flag.Parse()
 
 	log.Println("Connecting to services")
 
 	pgConnString := cfg.DatabaseURL
-	db, err := storage.NewDB(pgConnString)
+	db, err := storage.Open(pgConnString)
 	if err != nil {
 		log.Fatalf("DB Error: %v", err)
 	}
+	if err := db.CheckSchema(context.Background()); err != nil {
+		log.Fatalf("Schema check failed: %v", err)
+	}
 	defer db.Close()
 
 	esConfig := elasticsearch.Config{
@@ -62,36 +79,78 @@ func main() {
 		log.Fatalf("Error creating bulk indexer: %v", err)
 	}
 
-	var count uint64
-	start := time.Now()
-	log.Println("Syncing db with es...")
-
-	err = db.IteratePages(context.Background(), func(p models.ScrapedPage) error {
-		var codeBuilder strings.Builder
-		var textBuilder strings.Builder
-		for _, sec := range p.Sections {
-			if sec.Type == "code" {
-				codeBuilder.WriteString(sec.Content + "\n")
-			} else {
-				textBuilder.WriteString(sec.Content + "\n")
-			}
+	filter := storage.PageFilter{URLPrefix: *prefix}
+	if *source != "" {
+		registered, err := db.GetSourceByName(context.Background(), *source)
+		if err != nil {
+			log.Fatalf("Failed to load source %s: %v", *source, err)
 		}
-
-		doc := map[string]interface{}{
-			"url":           p.URL,
-			"title":         p.Title,
-			"content":       textBuilder.String(),
-			"code_snippets": codeBuilder.String(),
-			"crawled_at":    p.CrawledAt,
+		if registered != nil {
+			filter.SourceID = registered.ID
+		} else {
+			filter.Source = *source
 		}
+	}
+	switch {
+	case *since != "":
+		t, err := time.Parse(time.RFC3339, *since)
+		if err != nil {
+			log.Fatalf("Invalid -since: %v", err)
+		}
+		filter.UpdatedSince = t
+	case !*full && !*resetIndex:
+		t, err := db.Checkpoint(context.Background(), checkpointName)
+		if err != nil {
+			log.Fatalf("Failed to read checkpoint: %v", err)
+		}
+		filter.UpdatedSince = t
+	}
+	// only a sync of everything changed since the checkpoint moves it
+	partial := *since != "" || *source != "" || *prefix != ""
 
-		data, _ := json.Marshal(doc)
+	// notIndexed counts skipped pages that were already missing from the
+	// index, the bulk indexer reports those deletes as failures
+	var count, skipped, notIndexed uint64
+	start := time.Now()
+	if filter.UpdatedSince.IsZero() {
+		log.Println("Syncing db with es...")
+	} else {
+		log.Printf("Syncing pages changed since %s with es...", filter.UpdatedSince.Format(time.RFC3339))
+	}
+
+	err = db.IteratePages(context.Background(), filter, func(p models.ScrapedPage) error {
+		p.Quality = quality.Of(p)
+		if p.Quality < cfg.MinQuality {
+			// it may have been indexed when it scored higher
+			return bi.Add(
+				context.Background(),
+				esutil.BulkIndexerItem{
+					Action:     "delete",
+					DocumentID: p.URL,
+					OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+						switch {
+						case err != nil:
+							log.Printf("ERROR: %s", err)
+						case res.Status == http.StatusNotFound:
+							atomic.AddUint64(&skipped, 1)
+							atomic.AddUint64(&notIndexed, 1)
+						default:
+							log.Printf("ERROR: %s: %s", res.Error.Type, res.Error.Reason)
+						}
+					},
+					OnSuccess: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem) {
+						atomic.AddUint64(&skipped, 1)
+					},
+				},
+			)
+		}
+		data, _ := json.Marshal(search.NewDocument(p))
 
 		err := bi.Add(
 			context.Background(),
 			esutil.BulkIndexerItem{
 				Action:     "index",
-				DocumentID: p.URL, 
+				DocumentID: p.URL,
 				Body:       bytes.NewReader(data),
 				OnFailure: func(ctx context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
 					if err != nil {
@@ -124,5 +183,14 @@ func main() {
 	log.Printf("Indexed: %d documents", count)
 	log.Printf("Time:    %s", elapsed)
 	log.Printf("Rate:    %.0f docs/sec", rate)
-	log.Printf("Errors:  %d", stats.NumFailed)
+	log.Printf("Skipped: %d below quality %.2f, removed from the index", skipped, cfg.MinQuality)
+	log.Printf("Errors:  %d", stats.NumFailed-notIndexed)
+
+	// failed documents are retried by leaving the checkpoint where it was
+	if partial || stats.NumFailed > notIndexed {
+		return
+	}
+	if err := db.SaveCheckpoint(context.Background(), checkpointName, start.Add(-checkpointOverlap)); err != nil {
+		log.Fatalf("Failed to save checkpoint: %v", err)
+	}
 }
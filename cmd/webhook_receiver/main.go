@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+
+	"oss/internal/models"
+	"oss/internal/watch"
+)
+
+// webhook_receiver is a local endpoint for trying out watch webhooks: it
+// checks each delivery's signature and logs the event.
+func main() {
+	addr := flag.String("addr", ":9090", "Address to listen on")
+	secret := flag.String("secret", "", "Secret returned when the watch was created")
+	flag.Parse()
+	if *secret == "" {
+		log.Fatalf("-secret is required")
+	}
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !watch.Verify(*secret, body, r.Header.Get(watch.SignatureHeader)) {
+			log.Printf("rejected delivery %s: bad signature", r.Header.Get("X-Event-ID"))
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		var event models.WatchEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("event %d: %s (%s %q) %s version %d", event.ID, event.Message, event.Kind, event.Target, event.URL, event.Version)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	log.Printf("listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
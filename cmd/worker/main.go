@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"oss/internal/config"
+	"oss/internal/crawler"
+	"oss/internal/models"
+	"oss/internal/pipeline"
+	"oss/internal/search"
+	"oss/internal/storage"
+)
+
+// worker is a crawl worker sharing the database frontier with any number of
+// other workers, on this machine or, with postgres, others. Seed the frontier once with
+// -seed or -source, then start workers wherever there is capacity.
+func main() {
+	cfg := config.LoadConfig()
+	host, _ := os.Hostname()
+	id := flag.String("id", fmt.Sprintf("%s-%d", host, os.Getpid()), "Worker id, unique among running workers")
+	concurrency := flag.Int("concurrency", 4, "Urls fetched at once by this worker")
+	lease := flag.Duration("lease", 2*time.Minute, "How long a claimed url is held without a heartbeat")
+	poll := flag.Duration("poll", 2*time.Second, "How long to wait before claiming again when the frontier has nothing to fetch")
+	maxDepth := flag.Int("max-depth", 0, "Links followed from a start url, 0 for no limit")
+	maxAttempts := flag.Int("max-attempts", 3, "Give up on a url after this many failed fetches")
+	exitIdle := flag.Bool("exit-when-idle", false, "Stop once the frontier is empty instead of waiting for more urls")
+	seed := flag.String("seed", "", "Comma separated start urls to queue before working, their domains become crawlable")
+	domains := flag.String("domains", "", "Comma separated extra domains links may be followed to, with -seed")
+	sources := flag.String("source", "", "Comma separated registered sources whose domains and seeds are queued before working")
+	delay := flag.Duration("delay", time.Second, "Delay between fetches from one domain across all workers, with -seed, or -source when the source sets none")
+	recrawl := flag.Bool("recrawl", false, "With -seed or -source, queue every previously crawled url again")
+	seedOnly := flag.Bool("seed-only", false, "Seed the frontier and exit")
+	status := flag.Bool("status", false, "Print the frontier and workers and exit")
+	authFile := flag.String("auth", "", "Json file of per-domain credentials for private docs, secrets given as env:NAME or file:/path")
+	batchSize := flag.Int("batch", crawler.DefaultBatchSize, "Pages saved per transaction, 1 to save each page on its own")
+	deadLetters := flag.String("dead-letters", "dead_letters.jsonl", "File pages that fail to save are queued in, replay them with the retry command")
+	flag.Parse()
+
+	// the heartbeat ticks every third of the lease
+	if *lease < time.Second {
+		log.Fatalf("-lease must be at least 1s, got %v", *lease)
+	}
+	if *concurrency < 1 {
+		log.Fatalf("-concurrency must be at least 1, got %d", *concurrency)
+	}
+	if *poll <= 0 {
+		log.Fatalf("-poll must be positive, got %v", *poll)
+	}
+
+	db, err := storage.Open(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Error connecting to database: %v\n", err)
+	}
+	if err := db.CheckSchema(context.Background()); err != nil {
+		log.Fatalf("Schema check failed: %v", err)
+	}
+	defer db.Close()
+	db.SetKeepVersions(cfg.KeepVersions)
+
+	if *status {
+		printStatus(db, *lease)
+		return
+	}
+
+	if *seed != "" {
+		urls := splitList(*seed)
+		allowed := splitList(*domains)
+		if err := db.SeedFrontier(context.Background(), allowed, urls, *delay, *recrawl); err != nil {
+			log.Fatalf("Failed to seed frontier: %v", err)
+		}
+		log.Printf("Seeded frontier with %d urls", len(urls))
+	}
+	for _, name := range splitList(*sources) {
+		seedSource(db, name, *delay, *recrawl)
+	}
+	if *seedOnly {
+		return
+	}
+
+	es, _ := search.NewClient(cfg.ElasticsearchURL)
+	schema, _ := os.ReadFile("internal/search/schema.json")
+	es.InitIndex(context.Background(), schema)
+
+	saver := pipeline.DualSaver{
+		DB:         db,
+		ES:         es,
+		MinQuality: cfg.MinQuality,
+	}
+
+	c := crawler.NewCrawler(&saver)
+	c.DeadLetters = crawler.NewDeadLetterQueue(*deadLetters)
+	c.BatchSize = *batchSize
+	if *authFile != "" {
+		auth, err := crawler.LoadAuthConfig(*authFile)
+		if err != nil {
+			log.Fatalf("Failed to load auth config: %v", err)
+		}
+		if err := c.Authenticate(context.Background(), auth); err != nil {
+			log.Fatalf("Authentication failed: %v", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Worker %s starting...", *id)
+	err = c.Work(ctx, db, crawler.WorkerOptions{
+		ID:           *id,
+		Host:         host,
+		Concurrency:  *concurrency,
+		Lease:        *lease,
+		MaxDepth:     *maxDepth,
+		MaxAttempts:  *maxAttempts,
+		Poll:         *poll,
+		ExitWhenIdle: *exitIdle,
+	})
+	if err != nil {
+		log.Printf("Worker stopped with error: %v", err)
+	}
+
+	summary := c.Summary()
+	log.Printf("Worker %s stopped", *id)
+	log.Printf("Fetched:       %d", summary.Fetched)
+	log.Printf("Saved:         %d", summary.Saved)
+	log.Printf("Skipped:       %d", summary.Skipped)
+	log.Printf("Failed:        %d", summary.Failed)
+	log.Printf("Dead-lettered: %d (%s)", summary.DeadLettered, *deadLetters)
+	log.Printf("Fetch errors:  %d", summary.FetchErrors)
+
+	// the frontier is shared, so the run is recorded under the sources this
+	// worker was started with, or as a plain web crawl
+	runSource := models.SourceWeb
+	if names := splitList(*sources); len(names) > 0 {
+		runSource = strings.Join(names, ",")
+	}
+	run := summary.CrawlRun(runSource)
+	if err := db.SaveCrawlRun(context.Background(), &run); err != nil {
+		log.Printf("failed to save crawl run report: %v\n", err)
+		return
+	}
+	log.Printf("Saved run report %d", run.ID)
+}
+
+// seedSource queues a registered source's seeds and allows its domains,
+// with the delay from its settings when it has one.
+func seedSource(db storage.Store, name string, delay time.Duration, recrawl bool) {
+	ctx := context.Background()
+	source, err := db.GetSourceByName(ctx, name)
+	if err != nil {
+		log.Fatalf("Failed to load source %s: %v", name, err)
+	}
+	if source == nil {
+		log.Fatalf("No source named %s", name)
+	}
+	if !source.Enabled {
+		log.Fatalf("Source %s is disabled", name)
+	}
+	if source.Settings.DelayMS > 0 {
+		delay = time.Duration(source.Settings.DelayMS) * time.Millisecond
+	}
+	if err := db.SeedFrontier(ctx, source.Domains, source.Seeds, delay, recrawl); err != nil {
+		log.Fatalf("Failed to seed frontier from %s: %v", name, err)
+	}
+	log.Printf("Seeded frontier with %d urls from %s", len(source.Seeds), name)
+}
+
+func printStatus(db storage.Store, lease time.Duration) {
+	ctx := context.Background()
+	counts, err := db.FrontierCounts(ctx)
+	if err != nil {
+		log.Fatalf("Failed to read frontier: %v", err)
+	}
+	statuses := make([]string, 0, len(counts))
+	for s := range counts {
+		statuses = append(statuses, s)
+	}
+	sort.Strings(statuses)
+	fmt.Println("Frontier:")
+	for _, s := range statuses {
+		fmt.Printf("  %-8s %d\n", s, counts[s])
+	}
+
+	// a worker silent for a whole lease is presumed dead, its urls are
+	// claimable again by then
+	workers, err := db.ListWorkers(ctx, lease)
+	if err != nil {
+		log.Fatalf("Failed to list workers: %v", err)
+	}
+	fmt.Println("\nWorkers:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "  ID\tALIVE\tLAST HEARTBEAT\tFETCHED\tCURRENT URL")
+	for _, wk := range workers {
+		fmt.Fprintf(w, "  %s\t%v\t%s ago\t%d\t%s\n",
+			wk.ID, wk.Alive, time.Since(wk.HeartbeatAt).Round(time.Second), wk.Fetched, wk.CurrentURL)
+	}
+	w.Flush()
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
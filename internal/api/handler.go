@@ -1,17 +1,36 @@
 package api
 
 import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"oss/internal/models"
+	"oss/internal/search"
+	"oss/internal/storage"
+	"oss/internal/watch"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Handler struct {
 	Service *SearchService
+	DB      storage.Store
+	// NotifyTokens are the bearer tokens HandleNotify accepts
+	NotifyTokens []string
+	// UserTokens maps the bearer tokens of the handlers acting for a user,
+	// like the watch and source handlers, to that user. Any of them also
+	// lets a caller see private pages.
+	UserTokens map[string]string
 }
 
 type SearchRequest struct {
-	Query string `form:"q" binding:"required"`
+	Query  string `form:"q" binding:"required"`
+	Source string `form:"source"`
 }
 
 func (h *Handler) HandleSearch(c *gin.Context) {
@@ -22,15 +41,727 @@ func (h *Handler) HandleSearch(c *gin.Context) {
 		return
 	}
 
-	results, err := h.Service.SearchAndRank(c.Request.Context(), req.Query)
+	filter, err := h.searchFilter(c, req.Source)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Source lookup failed " + err.Error()})
+		return
+	}
+	filter.PublicOnly = !h.authenticated(c)
+	res, err := h.Service.SearchAndRank(c.Request.Context(), req.Query, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	body := gin.H{
 		"query":   req.Query,
-		"count":   len(results),
-		"results": results,
+		"count":   len(res.Results),
+		"results": res.Results,
+		"backend": res.Backend,
+	}
+	if res.FallbackReason != "" {
+		body["fallback_reason"] = res.FallbackReason
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// searchFilter narrows a search to a registered source when source names
+// one, otherwise to pages of that kind, e.g. web or stackexchange.
+func (h *Handler) searchFilter(c *gin.Context, source string) (search.Filter, error) {
+	if source == "" {
+		return search.Filter{}, nil
+	}
+	registered, err := h.DB.GetSourceByName(c.Request.Context(), source)
+	if err != nil {
+		return search.Filter{}, err
+	}
+	if registered != nil {
+		return search.Filter{SourceID: registered.ID}, nil
+	}
+	return search.Filter{Source: source}, nil
+}
+
+type SymbolRequest struct {
+	Name  string `form:"q" binding:"required"`
+	Limit int    `form:"limit"`
+}
+
+func (h *Handler) HandleSymbols(c *gin.Context) {
+	var req SymbolRequest
+
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'q' is required"})
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 20
+	}
+
+	symbols, err := h.DB.LookupSymbols(c.Request.Context(), req.Name, req.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Symbol lookup failed " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":   req.Name,
+		"count":   len(symbols),
+		"symbols": symbols,
+	})
+}
+
+type PageRequest struct {
+	URL string `form:"url" binding:"required"`
+}
+
+// HandlePage returns a stored page with its structured sections. Private
+// pages are only returned to authenticated callers.
+func (h *Handler) HandlePage(c *gin.Context) {
+	var req PageRequest
+
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'url' is required"})
+		return
+	}
+
+	page, err := h.DB.GetPage(c.Request.Context(), req.URL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Page lookup failed " + err.Error()})
+		return
+	}
+	if page == nil || (page.Private && !h.authenticated(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// visiblePage answers 404 and returns false when url isn't a stored page the
+// caller may see, private pages being only for authenticated callers.
+func (h *Handler) visiblePage(c *gin.Context, url string) bool {
+	page, err := h.DB.GetPage(c.Request.Context(), url)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Page lookup failed " + err.Error()})
+		return false
+	}
+	if page == nil || (page.Private && !h.authenticated(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+		return false
+	}
+	return true
+}
+
+type RunsRequest struct {
+	Source string `form:"source"`
+	Limit  int    `form:"limit"`
+}
+
+// HandleRuns lists recent crawl runs, latest first.
+func (h *Handler) HandleRuns(c *gin.Context) {
+	var req RunsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 20
+	}
+
+	runs, err := h.DB.ListCrawlRuns(c.Request.Context(), req.Source, req.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Run lookup failed " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count": len(runs),
+		"runs":  runs,
+	})
+}
+
+type CompareRunsRequest struct {
+	Base int64 `form:"base" binding:"required"`
+	Head int64 `form:"head" binding:"required"`
+}
+
+// HandleCompareRuns reports what changed between two crawl runs.
+func (h *Handler) HandleCompareRuns(c *gin.Context) {
+	var req CompareRunsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameters 'base' and 'head' are required"})
+		return
+	}
+
+	var runs [2]*models.CrawlRun
+	for i, id := range []int64{req.Base, req.Head} {
+		run, err := h.DB.GetCrawlRun(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Run lookup failed " + err.Error()})
+			return
+		}
+		if run == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Run %d not found", id)})
+			return
+		}
+		runs[i] = run
+	}
+
+	c.JSON(http.StatusOK, models.CompareRuns(runs[0], runs[1]))
+}
+
+// workers silent for longer than this are reported dead, it matches the
+// worker command's default lease
+const workerStaleAfter = 2 * time.Minute
+
+// HandleWorkers reports the shared crawl frontier and the workers on it.
+func (h *Handler) HandleWorkers(c *gin.Context) {
+	counts, err := h.DB.FrontierCounts(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Frontier lookup failed " + err.Error()})
+		return
+	}
+	workers, err := h.DB.ListWorkers(c.Request.Context(), workerStaleAfter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Worker lookup failed " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"frontier": counts,
+		"workers":  workers,
+	})
+}
+
+// notified urls are claimed before anything the crawl found itself
+const notifyPriority = 10
+
+// at most this many urls per notification
+const maxNotifyURLs = 1000
+
+// at most this many domains per notification, each queues all of its pages
+const maxNotifyDomains = 10
+
+type NotifyRequest struct {
+	URLs []string `json:"urls"`
+	// Domains recrawls every known page of each domain
+	Domains []string `json:"domains"`
+}
+
+// HandleNotify lets docs sites announce that pages changed. The pages are
+// queued for the crawl workers ahead of everything else, which saves them
+// to postgres and elasticsearch as usual. Callers authenticate with one of
+// the configured bearer tokens.
+func (h *Handler) HandleNotify(c *gin.Context) {
+	if len(h.NotifyTokens) == 0 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Change notifications are not enabled"})
+		return
+	}
+	if !h.validNotifyToken(c.GetHeader("Authorization")) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or missing bearer token"})
+		return
+	}
+
+	var req NotifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid body " + err.Error()})
+		return
+	}
+	if len(req.URLs) == 0 && len(req.Domains) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Body needs 'urls' or 'domains'"})
+		return
+	}
+	if len(req.URLs) > maxNotifyURLs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d urls per notification", maxNotifyURLs)})
+		return
+	}
+	if len(req.Domains) > maxNotifyDomains {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d domains per notification", maxNotifyDomains)})
+		return
+	}
+
+	ctx := c.Request.Context()
+	queued, err := h.DB.RequestRecrawl(ctx, req.URLs, notifyPriority)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue urls " + err.Error()})
+		return
+	}
+	isQueued := map[string]bool{}
+	for _, u := range queued {
+		isQueued[u] = true
+	}
+	ignored := []string{}
+	for _, u := range req.URLs {
+		if !isQueued[u] {
+			ignored = append(ignored, u)
+		}
+	}
+
+	count := len(queued)
+	for _, d := range req.Domains {
+		n, err := h.DB.RequestDomainRecrawl(ctx, d, notifyPriority)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue domain " + err.Error()})
+			return
+		}
+		count += n
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"queued":  count,
+		"ignored": ignored,
+	})
+}
+
+func (h *Handler) validNotifyToken(header string) bool {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	valid := false
+	// compare against every token so timing doesn't reveal which matched
+	for _, t := range h.NotifyTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// authUser returns the user the request's bearer token belongs to. It
+// responds with an error and returns false when there is no such user.
+func (h *Handler) authUser(c *gin.Context) (string, bool) {
+	if len(h.UserTokens) == 0 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "User tokens are not configured"})
+		return "", false
+	}
+	user := h.tokenUser(c)
+	if user == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or missing bearer token"})
+		return "", false
+	}
+	return user, true
+}
+
+// authenticated reports whether the request carries a user's bearer token.
+func (h *Handler) authenticated(c *gin.Context) bool {
+	return h.tokenUser(c) != ""
+}
+
+// tokenUser returns the user of the request's bearer token, empty when it has
+// none or it isn't one of UserTokens.
+func (h *Handler) tokenUser(c *gin.Context) string {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return ""
+	}
+	user := ""
+	// compare against every token so timing doesn't reveal which matched
+	for t, u := range h.UserTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			user = u
+		}
+	}
+	return user
+}
+
+// HandleVersions lists the kept versions of a page, newest first.
+func (h *Handler) HandleVersions(c *gin.Context) {
+	var req PageRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'url' is required"})
+		return
+	}
+
+	if !h.visiblePage(c, req.URL) {
+		return
+	}
+
+	versions, err := h.DB.ListVersions(c.Request.Context(), req.URL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Version lookup failed " + err.Error()})
+		return
+	}
+	if len(versions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"url":      req.URL,
+		"count":    len(versions),
+		"versions": versions,
 	})
 }
+
+type DiffRequest struct {
+	URL string `form:"url" binding:"required"`
+	// From defaults to the version before To, To to the latest
+	From int `form:"from"`
+	To   int `form:"to"`
+}
+
+// HandleDiff shows the section changes between two versions of a page.
+func (h *Handler) HandleDiff(c *gin.Context) {
+	var req DiffRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'url' is required"})
+		return
+	}
+	if !h.visiblePage(c, req.URL) {
+		return
+	}
+	ctx := c.Request.Context()
+
+	to, err := h.DB.GetVersion(ctx, req.URL, req.To)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Version lookup failed " + err.Error()})
+		return
+	}
+	if to == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		return
+	}
+	if req.From == 0 {
+		req.From = to.Version - 1
+	}
+	if req.From <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Page has no earlier version"})
+		return
+	}
+	from, err := h.DB.GetVersion(ctx, req.URL, req.From)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Version lookup failed " + err.Error()})
+		return
+	}
+	if from == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Version %d not found, it may have been pruned", req.From)})
+		return
+	}
+
+	changes := models.DiffSections(from.Page.Sections, to.Page.Sections)
+	if changes == nil {
+		changes = []models.SectionChange{}
+	}
+	res := gin.H{
+		"url":     req.URL,
+		"from":    from.Version,
+		"to":      to.Version,
+		"changes": changes,
+	}
+	if from.Title != to.Title {
+		res["title"] = gin.H{"from": from.Title, "to": to.Title}
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+type WatchRequest struct {
+	Kind   string `json:"kind" binding:"required"`
+	Target string `json:"target" binding:"required"`
+	// WebhookURL is optional, events always go to the user's feed
+	WebhookURL string `json:"webhook_url"`
+}
+
+// HandleCreateWatch subscribes the authenticated user to a page, symbol or
+// query. The response holds the secret webhook deliveries are signed with,
+// it isn't shown again.
+func (h *Handler) HandleCreateWatch(c *gin.Context) {
+	user, ok := h.authUser(c)
+	if !ok {
+		return
+	}
+	var req WatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Fields 'kind' and 'target' are required"})
+		return
+	}
+	if !watch.ValidKind(req.Kind) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kind must be page, symbol or query"})
+		return
+	}
+	if req.WebhookURL != "" && !watch.ValidWebhook(req.WebhookURL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook must be an http or https url"})
+		return
+	}
+
+	w := &models.Watch{
+		User:       user,
+		Kind:       req.Kind,
+		Target:     req.Target,
+		WebhookURL: req.WebhookURL,
+	}
+	if w.WebhookURL != "" {
+		secret, err := watch.NewSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create secret " + err.Error()})
+			return
+		}
+		w.Secret = secret
+	}
+	if err := h.DB.CreateWatch(c.Request.Context(), w); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create watch " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, w)
+}
+
+// HandleWatches lists the authenticated user's watches.
+func (h *Handler) HandleWatches(c *gin.Context) {
+	user, ok := h.authUser(c)
+	if !ok {
+		return
+	}
+
+	watches, err := h.DB.ListWatches(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Watch lookup failed " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":   len(watches),
+		"watches": watches,
+	})
+}
+
+// HandleDeleteWatch unsubscribes the authenticated user from a watch.
+func (h *Handler) HandleDeleteWatch(c *gin.Context) {
+	user, ok := h.authUser(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid watch id"})
+		return
+	}
+
+	found, err := h.DB.DeleteWatch(c.Request.Context(), id, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete watch " + err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Watch not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type FeedRequest struct {
+	// Since returns only events after this event id, for polling
+	Since int64 `form:"since"`
+	Limit int   `form:"limit"`
+}
+
+// HandleFeed returns the authenticated user's watch events, newest first.
+// Polling with since returns the oldest events after it instead, so that
+// following the last id returned pages through every event.
+func (h *Handler) HandleFeed(c *gin.Context) {
+	user, ok := h.authUser(c)
+	if !ok {
+		return
+	}
+	var req FeedRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 50
+	}
+
+	events, err := h.DB.Feed(c.Request.Context(), user, req.Since, req.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Feed lookup failed " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":  len(events),
+		"events": events,
+	})
+}
+
+type SourceRequest struct {
+	Name     string                `json:"name" binding:"required"`
+	Domains  []string              `json:"domains" binding:"required"`
+	Seeds    []string              `json:"seeds" binding:"required"`
+	Settings models.SourceSettings `json:"settings"`
+	// Enabled defaults to true
+	Enabled *bool `json:"enabled"`
+}
+
+func (r SourceRequest) source(owner string) models.Source {
+	return models.Source{
+		Name:     r.Name,
+		Domains:  r.Domains,
+		Seeds:    r.Seeds,
+		Settings: r.Settings,
+		Owner:    owner,
+		Enabled:  r.Enabled == nil || *r.Enabled,
+	}
+}
+
+type SourcesRequest struct {
+	Enabled bool `form:"enabled"`
+}
+
+// HandleSources lists the registered sources, only enabled ones with
+// enabled=true.
+func (h *Handler) HandleSources(c *gin.Context) {
+	var req SourcesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sources, err := h.DB.ListSources(c.Request.Context(), req.Enabled)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Source lookup failed " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":   len(sources),
+		"sources": sources,
+	})
+}
+
+// HandleSource returns one registered source.
+func (h *Handler) HandleSource(c *gin.Context) {
+	id, ok := sourceID(c)
+	if !ok {
+		return
+	}
+
+	source, err := h.DB.GetSource(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Source lookup failed " + err.Error()})
+		return
+	}
+	if source == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Source not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, source)
+}
+
+// HandleCreateSource registers a site to crawl, owned by the authenticated
+// user.
+func (h *Handler) HandleCreateSource(c *gin.Context) {
+	user, ok := h.authUser(c)
+	if !ok {
+		return
+	}
+	var req SourceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Fields 'name', 'domains' and 'seeds' are required"})
+		return
+	}
+	source := req.source(user)
+	if err := source.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.DB.CreateSource(c.Request.Context(), &source)
+	if errors.Is(err, storage.ErrSourceExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create source " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, source)
+}
+
+// HandleUpdateSource replaces a source's settings. Sources with an owner
+// can only be changed by that owner, an unowned one becomes the
+// authenticated user's.
+func (h *Handler) HandleUpdateSource(c *gin.Context) {
+	user, ok := h.authUser(c)
+	if !ok {
+		return
+	}
+	id, ok := sourceID(c)
+	if !ok {
+		return
+	}
+	var req SourceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Fields 'name', 'domains' and 'seeds' are required"})
+		return
+	}
+	source := req.source(user)
+	source.ID = id
+	if err := source.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := h.DB.UpdateSource(c.Request.Context(), &source)
+	if errors.Is(err, storage.ErrSourceExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update source " + err.Error()})
+		return
+	}
+	if updated == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Source not found or owned by someone else"})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// HandleDisableSource stops a source being crawled. Its pages stay
+// searchable.
+func (h *Handler) HandleDisableSource(c *gin.Context) {
+	h.setSourceEnabled(c, false)
+}
+
+// HandleEnableSource resumes crawling a disabled source.
+func (h *Handler) HandleEnableSource(c *gin.Context) {
+	h.setSourceEnabled(c, true)
+}
+
+func (h *Handler) setSourceEnabled(c *gin.Context, enabled bool) {
+	user, ok := h.authUser(c)
+	if !ok {
+		return
+	}
+	id, ok := sourceID(c)
+	if !ok {
+		return
+	}
+
+	found, err := h.DB.SetSourceEnabled(c.Request.Context(), id, user, enabled)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update source " + err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Source not found or owned by someone else"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// sourceID parses the :id path parameter, answering 400 if it's invalid.
+func sourceID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid source id"})
+		return 0, false
+	}
+	return id, true
+}
@@ -3,6 +3,8 @@ package api
 import (
 	"context"
 	"fmt"
+	"log"
+	"sort"
 	"time"
 
 	"oss/internal/models"
@@ -13,20 +15,104 @@ import (
 type SearchService struct {
 	ESClient *search.Client
 	MLClient pb.MLServiceClient
+	// Fallback is searched when elasticsearch fails or takes longer than
+	// Timeout, when set
+	Fallback *search.Database
+	Timeout  time.Duration
+}
+
+// BackendElasticsearch is reported with results found by elasticsearch,
+// fallback results report the database dialect, e.g. postgres
+const BackendElasticsearch = "elasticsearch"
+
+// how long elasticsearch gets when SearchService.Timeout isn't set
+const defaultSearchTimeout = 2 * time.Second
+
+// SearchResponse holds ranked results and the backend that found them.
+type SearchResponse struct {
+	Results []Result
+	Backend string
+	// FallbackReason is why elasticsearch wasn't used, empty if it was
+	FallbackReason string
 }
 
 type Result struct {
-	Title string  `json:"title"`
-	URL   string  `json:"url"`
-	Score float64 `json:"score"`
-	Text  string  `json:"text"`
+	Title  string  `json:"title"`
+	URL    string  `json:"url"`
+	Score  float64 `json:"score"`
+	Text   string  `json:"text"`
+	Source string  `json:"source,omitempty"`
+
+	Description string   `json:"description,omitempty"`
+	Breadcrumbs []string `json:"breadcrumbs,omitempty"`
+	LastUpdated string   `json:"last_updated,omitempty"`
+	Deprecated  bool     `json:"deprecated,omitempty"`
+	Quality     float64  `json:"quality,omitempty"`
+	Private     bool     `json:"private,omitempty"`
+	SourceID    int64    `json:"source_id,omitempty"`
+}
+
+// the reranker doesn't know about deprecation, so deprecated pages have
+// their score scaled by this afterwards
+const deprecatedPenalty = 0.5
+
+func newResult(page models.ScrapedPage, score float64) Result {
+	return Result{
+		Title:       page.Title,
+		URL:         page.URL,
+		Score:       score,
+		Text:        page.Sections[0].Content,
+		Source:      page.Source,
+		Description: page.Description,
+		Breadcrumbs: page.Breadcrumbs,
+		LastUpdated: page.LastUpdated,
+		Deprecated:  page.Deprecated != "",
+		Quality:     page.Quality,
+		Private:     page.Private,
+		SourceID:    page.SourceID,
+	}
 }
 
-func (s *SearchService) SearchAndRank(ctx context.Context, query string) ([]Result, error) {
-	candidates, err := s.ESClient.Search(ctx, query)
+func (s *SearchService) SearchAndRank(ctx context.Context, query string, filter search.Filter) (*SearchResponse, error) {
+	candidates, res, err := s.candidates(ctx, query, filter)
 	if err != nil {
-		return nil, fmt.Errorf("elastic search failed: %w", err)
+		return nil, err
+	}
+	res.Results, err = s.rank(ctx, query, candidates)
+	return res, err
+}
+
+// candidates searches elasticsearch, or the fallback when elasticsearch
+// errors or times out.
+func (s *SearchService) candidates(ctx context.Context, query string, filter search.Filter) ([]models.ScrapedPage, *SearchResponse, error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultSearchTimeout
 	}
+	esCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	candidates, err := s.ESClient.Search(esCtx, query, filter)
+	if err == nil {
+		return candidates, &SearchResponse{Backend: BackendElasticsearch}, nil
+	}
+	// a cancelled request isn't worth a second search
+	if s.Fallback == nil || ctx.Err() != nil {
+		return nil, nil, fmt.Errorf("elastic search failed: %w", err)
+	}
+
+	backend := s.Fallback.Name()
+	log.Printf("elastic search failed, falling back to %s: %v", backend, err)
+	candidates, dbErr := s.Fallback.Search(ctx, query, filter)
+	if dbErr != nil {
+		return nil, nil, fmt.Errorf("elastic search failed: %v, %s fallback failed: %w", err, backend, dbErr)
+	}
+	return candidates, &SearchResponse{Backend: backend, FallbackReason: err.Error()}, nil
+}
+
+// rank reorders candidates with the ml reranker, keeping the backend's
+// order if it's unavailable.
+func (s *SearchService) rank(ctx context.Context, query string, candidates []models.ScrapedPage) ([]Result, error) {
 	if len(candidates) == 0 {
 		return []Result{}, nil
 	}
@@ -77,12 +163,7 @@ func (s *SearchService) mapToResults(
 	// fallback mode
 	if ranked == nil {
 		for _, page := range original {
-			final = append(final, Result{
-				Title: page.Title,
-				URL:   page.URL,
-				Score: 1.0,
-				Text:  page.Sections[0].Content,
-			})
+			final = append(final, newResult(page, 1.0))
 		}
 		return final
 	}
@@ -90,12 +171,14 @@ func (s *SearchService) mapToResults(
 	docMap := lookup[0]
 	for _, hit := range ranked {
 		originalDoc := docMap[hit.Id]
-		final = append(final, Result{
-			Title: originalDoc.Title,
-			URL:   originalDoc.URL,
-			Score: float64(hit.Score),
-			Text:  originalDoc.Sections[0].Content,
-		})
+		result := newResult(originalDoc, float64(hit.Score))
+		if result.Deprecated {
+			result.Score *= deprecatedPenalty
+		}
+		final = append(final, result)
 	}
+	sort.SliceStable(final, func(i, j int) bool {
+		return final[i].Score > final[j].Score
+	})
 	return final
 }
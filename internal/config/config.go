@@ -2,6 +2,9 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,6 +14,19 @@ type Config struct {
 	ElasticsearchURL string
 	MLServiceAddr    string
 	Port             string
+	// pages scoring below this are stored but not indexed
+	MinQuality float64
+	// bearer tokens accepted by the change notification endpoint, which is
+	// disabled when there are none
+	NotifyTokens []string
+	// bearer tokens of the endpoints acting for a user, mapped to that
+	// user; they are disabled when there are none
+	UserTokens map[string]string
+	// snapshots kept per page, see storage.Store.SetKeepVersions
+	KeepVersions int
+	// how long a search waits for elasticsearch before falling back to
+	// the database
+	SearchTimeout time.Duration
 }
 
 func LoadConfig() *Config {
@@ -21,6 +37,11 @@ func LoadConfig() *Config {
 		ElasticsearchURL: getEnv("ELASTICSEARCH_URL", "http://localhost:9200"),
 		MLServiceAddr:    getEnv("ML_SERVICE_ADDR", "localhost:50051"),
 		Port:             getEnv("PORT", "8080"),
+		MinQuality:       getEnvFloat("MIN_QUALITY", 0.2),
+		NotifyTokens:     getEnvList("NOTIFY_TOKENS"),
+		UserTokens:       getEnvTokens("USER_TOKENS"),
+		KeepVersions:     getEnvInt("KEEP_VERSIONS", 20),
+		SearchTimeout:    time.Duration(getEnvInt("SEARCH_TIMEOUT_MS", 2000)) * time.Millisecond,
 	}
 }
 
@@ -30,3 +51,46 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// getEnvList splits a comma separated variable, dropping empty items.
+func getEnvList(key string) []string {
+	var out []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// getEnvTokens reads comma separated user:token pairs into a map from token
+// to user, dropping malformed pairs.
+func getEnvTokens(key string) map[string]string {
+	tokens := map[string]string{}
+	for _, pair := range getEnvList(key) {
+		user, token, ok := strings.Cut(pair, ":")
+		user, token = strings.TrimSpace(user), strings.TrimSpace(token)
+		if ok && user != "" && token != "" {
+			tokens[token] = user
+		}
+	}
+	return tokens
+}
+
+func getEnvInt(key string, fallback int) int {
+	if value, ok := os.LookupEnv(key); ok {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	if value, ok := os.LookupEnv(key); ok {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,268 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// AuthConfig is how to sign in to one documentation site. Secret values are
+// references rather than the secrets themselves: "env:NAME" reads an
+// environment variable and "file:/path" the contents of a file. Anything else
+// is used as is, which is meant for usernames and header names.
+type AuthConfig struct {
+	// Domain is the host the settings apply to, subdomains included
+	Domain  string            `json:"domain"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Bearer  string            `json:"bearer,omitempty"`
+	Basic   *BasicAuth        `json:"basic,omitempty"`
+	// CookieFile is a Netscape cookies.txt, as exported by browsers and curl
+	CookieFile string     `json:"cookie_file,omitempty"`
+	Login      *FormLogin `json:"login,omitempty"`
+}
+
+type BasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// FormLogin posts a login form before crawling and keeps the session
+// cookies it sets.
+type FormLogin struct {
+	URL    string            `json:"url"`
+	Fields map[string]string `json:"fields"`
+}
+
+// LoadAuthConfig reads a json list of AuthConfig.
+func LoadAuthConfig(path string) ([]AuthConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []AuthConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for i, c := range configs {
+		if c.Domain == "" {
+			return nil, fmt.Errorf("%s: entry %d has no domain", path, i)
+		}
+	}
+	return configs, nil
+}
+
+// resolveSecret looks up an env: or file: reference.
+func resolveSecret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	case strings.HasPrefix(ref, "file:"):
+		data, err := os.ReadFile(strings.TrimPrefix(ref, "file:"))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return ref, nil
+}
+
+// siteAuth is an AuthConfig with its secrets resolved into request headers.
+type siteAuth struct {
+	domain  string
+	headers http.Header
+}
+
+func (a *siteAuth) matches(host string) bool {
+	host = strings.ToLower(host)
+	return host == a.domain || strings.HasSuffix(host, "."+a.domain)
+}
+
+// Authenticate sets up the crawler to send credentials to the configured
+// domains: headers on every request to them, cookies from cookie files and
+// form logins in the collector's jar. Pages from these domains are marked
+// private.
+func (crawler *Crawler) Authenticate(ctx context.Context, configs []AuthConfig) error {
+	for _, c := range configs {
+		auth, err := resolveAuth(c)
+		if err != nil {
+			return fmt.Errorf("auth for %s: %v", c.Domain, err)
+		}
+
+		if c.CookieFile != "" {
+			if err := crawler.loadCookies(c.CookieFile); err != nil {
+				return fmt.Errorf("auth for %s: %v", c.Domain, err)
+			}
+		}
+		if c.Login != nil {
+			if err := crawler.formLogin(ctx, c.Login, auth.headers); err != nil {
+				return fmt.Errorf("login to %s: %v", c.Domain, err)
+			}
+		}
+		crawler.auth = append(crawler.auth, auth)
+	}
+
+	crawler.Collector.OnRequest(func(r *colly.Request) {
+		if auth := crawler.authFor(r.URL.Hostname()); auth != nil {
+			for name, values := range auth.headers {
+				for _, v := range values {
+					r.Headers.Set(name, v)
+				}
+			}
+		}
+	})
+	return nil
+}
+
+func (crawler *Crawler) authFor(host string) *siteAuth {
+	for _, a := range crawler.auth {
+		if a.matches(host) {
+			return a
+		}
+	}
+	return nil
+}
+
+func resolveAuth(c AuthConfig) (*siteAuth, error) {
+	auth := &siteAuth{
+		domain:  strings.ToLower(c.Domain),
+		headers: http.Header{},
+	}
+	for name, ref := range c.Headers {
+		value, err := resolveSecret(ref)
+		if err != nil {
+			return nil, err
+		}
+		auth.headers.Set(name, value)
+	}
+	if c.Bearer != "" {
+		token, err := resolveSecret(c.Bearer)
+		if err != nil {
+			return nil, err
+		}
+		auth.headers.Set("Authorization", "Bearer "+token)
+	}
+	if c.Basic != nil {
+		user, err := resolveSecret(c.Basic.Username)
+		if err != nil {
+			return nil, err
+		}
+		pass, err := resolveSecret(c.Basic.Password)
+		if err != nil {
+			return nil, err
+		}
+		auth.headers.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+pass)))
+	}
+	return auth, nil
+}
+
+// loadCookies reads a Netscape cookies.txt into the collector's jar.
+func (crawler *Crawler) loadCookies(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		httpOnly := false
+		if rest, ok := strings.CutPrefix(line, "#HttpOnly_"); ok {
+			line, httpOnly = rest, true
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return fmt.Errorf("%s: malformed cookie line %q", path, line)
+		}
+		domain, secure := fields[0], fields[3] == "TRUE"
+		cookie := &http.Cookie{
+			Domain:   domain,
+			Path:     fields[2],
+			Secure:   secure,
+			HttpOnly: httpOnly,
+			Name:     fields[5],
+			Value:    fields[6],
+		}
+		if expires, err := strconv.ParseInt(fields[4], 10, 64); err == nil && expires > 0 {
+			cookie.Expires = time.Unix(expires, 0)
+		}
+
+		scheme := "http"
+		if secure {
+			scheme = "https"
+		}
+		u := &url.URL{Scheme: scheme, Host: strings.TrimPrefix(domain, "."), Path: cookie.Path}
+		if err := crawler.Collector.SetCookies(u.String(), []*http.Cookie{cookie}); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// formLogin posts the login form with its own client, then hands the
+// session cookies to the collector. Going through the collector would run
+// the login response through the page callbacks.
+func (crawler *Crawler) formLogin(ctx context.Context, login *FormLogin, headers http.Header) error {
+	form := url.Values{}
+	for name, ref := range login.Fields {
+		value, err := resolveSecret(ref)
+		if err != nil {
+			return err
+		}
+		form.Set(name, value)
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Jar: jar, Timeout: 30 * time.Second}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, login.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("login returned %s", res.Status)
+	}
+
+	// the session may have been set on the login url or after redirects
+	for _, u := range []*url.URL{req.URL, res.Request.URL} {
+		cookies := jar.Cookies(u)
+		if len(cookies) == 0 {
+			continue
+		}
+		root := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}
+		if err := crawler.Collector.SetCookies(root.String(), cookies); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,23 +2,90 @@ package crawler
 
 import (
 	"context"
-	"fmt"
 	"log"
+	"maps"
 	"oss/internal/models"
+	"oss/internal/quality"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/PuerkitoBio/goquery"
 	"github.com/gocolly/colly/v2"
 	"github.com/gocolly/colly/v2/extensions"
 )
 
+// ContentSelector matches the element holding a page's documentation body.
+const ContentSelector = "article, main, div[role='main'], .documentation"
+
 type Saver interface {
 	SavePage(ctx context.Context, doc models.ScrapedPage) error
 }
 
+// BatchSaver is implemented by savers that store many pages faster than one
+// at a time. SavePages returns why each page failed, nil for those saved.
+type BatchSaver interface {
+	SavePages(ctx context.Context, pages []models.ScrapedPage) []error
+}
+
+// DefaultBatchSize is how many pages are saved at once when the saver is a
+// BatchSaver and Crawler.BatchSize isn't set.
+const DefaultBatchSize = 100
+
+// flushInterval bounds how long a page waits for its batch to fill, so a
+// crawl that dies loses little.
+const flushInterval = 10 * time.Second
+
 type Crawler struct {
 	Collector *colly.Collector
 	saver     Saver
+	// DeadLetters receives pages that fail to save, when set
+	DeadLetters *DeadLetterQueue
+	// sites with credentials, see Authenticate
+	auth []*siteAuth
+	// the registered source being crawled, see CrawlSource
+	sourceID int64
+	// BatchSize is how many pages are buffered for a BatchSaver,
+	// DefaultBatchSize when zero and no buffering when 1
+	BatchSize int
+
+	mu      sync.Mutex
+	summary Summary
+	// pages waiting to be saved as a batch
+	pending []models.ScrapedPage
+	// held while a batch is saved, so Flush returns once earlier batches
+	// are saved too
+	saving sync.Mutex
+	// set by Stop, requests not yet sent are aborted
+	stopped atomic.Bool
+}
+
+// Summary counts what happened to the pages of a crawl.
+type Summary struct {
+	StartedAt  time.Time
+	FinishedAt time.Time
+	// responses received, whatever their status
+	Fetched int
+	Bytes   int64
+	// responses by http status code
+	Statuses map[int]int
+
+	Saved int
+	// pages with no extractable sections
+	Skipped int
+	Failed  int
+	// failed pages written to the dead-letter queue
+	DeadLettered int
+	// urls that couldn't be fetched
+	FetchErrors int
+	// failure reasons, fetch and save, and how often each occurred
+	Errors map[string]int
+	// the same failures grouped by type, see errorType
+	ErrorTypes map[string]int
+	// the slowest fetches, slowest first
+	SlowURLs []models.URLTiming
 }
 
 func NewCrawler(saver Saver) *Crawler {
@@ -39,61 +106,83 @@ func NewCrawler(saver Saver) *Crawler {
 }
 
 func (crawler *Crawler) Crawl(domains []string, startURLs []string) {
+	crawler.crawl(startURLs, 4, 1*time.Second)
+}
+
+// CrawlSource crawls a registered source with its settings, its pages are
+// saved with the source's id.
+func (crawler *Crawler) CrawlSource(source models.Source) {
+	parallelism, delay := 4, 1*time.Second
+	if source.Settings.Parallelism > 0 {
+		parallelism = source.Settings.Parallelism
+	}
+	if source.Settings.DelayMS > 0 {
+		delay = time.Duration(source.Settings.DelayMS) * time.Millisecond
+	}
+	crawler.sourceID = source.ID
+	crawler.Collector.AllowedDomains = source.Domains
+	crawler.Collector.MaxDepth = source.Settings.MaxDepth
+	crawler.crawl(source.Seeds, parallelism, delay)
+}
 
+func (crawler *Crawler) crawl(startURLs []string, parallelism int, delay time.Duration) {
 	crawler.Collector.Limit(&colly.LimitRule{
 		DomainGlob:  "*",
-		Parallelism: 4,
-		Delay:       1 * time.Second,
+		Parallelism: parallelism,
+		Delay:       delay,
 	})
 
-	crawler.Collector.OnError(func(r *colly.Response, err error) {
-		log.Printf("error visiting %s: %v \n", r.Request.URL, err)
+	crawler.record(func(s *Summary) { s.StartedAt = time.Now() })
+	crawler.handlePages(func(e *colly.HTMLElement, link string) {
+		e.Request.Visit(link)
 	})
 
-	// heuristic searching for article, main, or generic divs
-	crawler.Collector.OnHTML("article, main, div[role='main'], .documentation", func(e *colly.HTMLElement) {
-		page := models.ScrapedPage{
+	stopFlushing := crawler.flushEvery(flushInterval)
+	for _, url := range startURLs {
+		crawler.Collector.Visit(url)
+	}
 
-			URL:       e.Request.URL.String(),
-			Title:     e.ChildText("h1"),
-			CrawledAt: time.Now().Format(time.RFC3339),
-		}
+	crawler.Collector.Wait()
+	stopFlushing()
+	crawler.Flush()
+	crawler.record(func(s *Summary) { s.FinishedAt = time.Now() })
+}
 
-		if page.Title == "" {
-			page.Title = e.DOM.Find("title").Text()
+// handlePages registers the callbacks that extract and save pages and keep
+// the summary. follow is called with every absolute link worth crawling.
+func (crawler *Crawler) handlePages(follow func(e *colly.HTMLElement, link string)) {
+	crawler.Collector.OnRequest(func(r *colly.Request) {
+		if crawler.stopped.Load() {
+			r.Abort()
+			return
 		}
+		r.Ctx.Put(requestStartKey, time.Now())
+	})
+	crawler.Collector.OnResponse(crawler.recordResponse)
 
-		e.ForEach("p, pre, h2, h3", func(_ int, el *colly.HTMLElement) {
-			tagName := el.Name
-			text := strings.TrimSpace(el.Text)
-
-			if text == "" {
-				return
-			}
-
-			switch tagName {
-			case "pre":
-				// likely a code block
-				page.Sections = append(page.Sections, models.PageSection{
-					Type:     "code",
-					Content:  text,
-					Language: "detected",
-				})
-			case "h2", "h3":
-				page.Sections = append(page.Sections, models.PageSection{
-					Type:    "text",
-					Content: "## " + text, // header in markdown
-				})
-			default:
-				page.Sections = append(page.Sections, models.PageSection{
-					Type:    "text",
-					Content: text,
-				})
-			}
+	crawler.Collector.OnError(func(r *colly.Response, err error) {
+		log.Printf("error visiting %s: %v \n", r.Request.URL, err)
+		if r.StatusCode != 0 {
+			crawler.recordResponse(r)
+		}
+		crawler.record(func(s *Summary) {
+			s.FetchErrors++
+			s.Errors["fetch: "+err.Error()]++
+			s.ErrorTypes[errorType(err, r.StatusCode)]++
 		})
+	})
+
+	// heuristic searching for article, main, or generic divs
+	crawler.Collector.OnHTML(ContentSelector, func(e *colly.HTMLElement) {
+		page := ExtractPage(e.Request.URL.String(), e.DOM)
+		page.Source = models.SourceWeb
+		page.Private = crawler.authFor(e.Request.URL.Hostname()) != nil
+		page.SourceID = crawler.sourceID
 
 		if len(page.Sections) > 0 {
 			crawler.savePage(page)
+		} else {
+			crawler.record(func(s *Summary) { s.Skipped++ })
 		}
 	})
 
@@ -101,25 +190,286 @@ func (crawler *Crawler) Crawl(domains []string, startURLs []string) {
 		link := e.Attr("href")
 		// todo! remove login or signups
 		if isDocsLink(link) {
-			e.Request.Visit(e.Request.AbsoluteURL(link))
+			follow(e, e.Request.AbsoluteURL(link))
 		}
 	})
-
-	for _, url := range startURLs {
-		crawler.Collector.Visit(url)
-	}
-
-	crawler.Collector.Wait()
 }
 
 func (crawler *Crawler) savePage(p models.ScrapedPage) {
+	if batch, ok := crawler.saver.(BatchSaver); ok && crawler.BatchSize != 1 {
+		size := crawler.BatchSize
+		if size <= 0 {
+			size = DefaultBatchSize
+		}
+		crawler.mu.Lock()
+		crawler.pending = append(crawler.pending, p)
+		var pages []models.ScrapedPage
+		if len(crawler.pending) >= size {
+			pages, crawler.pending = crawler.pending, nil
+		}
+		crawler.mu.Unlock()
+		if pages != nil {
+			crawler.saveBatch(batch, pages)
+		}
+		return
+	}
+
 	ctx := context.Background()
 	err := crawler.saver.SavePage(ctx, p)
+	crawler.saved(p, err)
+}
+
+// Flush saves the pages still waiting for a batch, after any batch already
+// being saved. It is safe to call while crawling.
+func (crawler *Crawler) Flush() {
+	crawler.saving.Lock()
+	defer crawler.saving.Unlock()
+	crawler.mu.Lock()
+	pages := crawler.pending
+	crawler.pending = nil
+	crawler.mu.Unlock()
+	if batch, ok := crawler.saver.(BatchSaver); ok && len(pages) > 0 {
+		crawler.writeBatch(batch, pages)
+	}
+}
+
+// Stop ends a crawl early: pages being fetched are still saved, urls not
+// yet requested are dropped, and Crawl or CrawlSource returns as usual.
+func (crawler *Crawler) Stop() {
+	crawler.stopped.Store(true)
+}
+
+// Stopped reports whether Stop was called.
+func (crawler *Crawler) Stopped() bool {
+	return crawler.stopped.Load()
+}
+
+// flushEvery flushes every interval until the returned stop is called,
+// which waits for a flush in progress.
+func (crawler *Crawler) flushEvery(interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				crawler.Flush()
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func (crawler *Crawler) saveBatch(saver BatchSaver, pages []models.ScrapedPage) {
+	crawler.saving.Lock()
+	defer crawler.saving.Unlock()
+	crawler.writeBatch(saver, pages)
+}
+
+// writeBatch saves pages, the caller holds saving.
+func (crawler *Crawler) writeBatch(saver BatchSaver, pages []models.ScrapedPage) {
+	errs := saver.SavePages(context.Background(), pages)
+	for i, p := range pages {
+		crawler.saved(p, errs[i])
+	}
+}
+
+// saved records the outcome of saving a page.
+func (crawler *Crawler) saved(p models.ScrapedPage, err error) {
 	if err != nil {
 		log.Printf("failed to save page to DB :%v\n", err)
+		crawler.deadLetter(p, err)
 		return
 	}
-	fmt.Printf("sections saved to db: %s, (%d, sections)\n", p.Title, len(p.Sections))
+	crawler.record(func(s *Summary) { s.Saved++ })
+	log.Printf("sections saved: %s, (%d, sections)\n", p.Title, len(p.Sections))
+}
+
+func (crawler *Crawler) deadLetter(p models.ScrapedPage, saveErr error) {
+	queued := false
+	if crawler.DeadLetters != nil {
+		err := crawler.DeadLetters.Add(DeadLetter{
+			Page:     p,
+			Error:    saveErr.Error(),
+			Attempts: 1,
+			FailedAt: time.Now().Format(time.RFC3339),
+		})
+		if err != nil {
+			log.Printf("failed to dead-letter %s: %v\n", p.URL, err)
+		}
+		queued = err == nil
+	}
+	crawler.record(func(s *Summary) {
+		s.Failed++
+		s.Errors["save: "+saveErr.Error()]++
+		s.ErrorTypes["save"]++
+		if queued {
+			s.DeadLettered++
+		}
+	})
+}
+
+func (crawler *Crawler) record(update func(*Summary)) {
+	crawler.mu.Lock()
+	defer crawler.mu.Unlock()
+	if crawler.summary.Errors == nil {
+		crawler.summary.Errors = map[string]int{}
+		crawler.summary.ErrorTypes = map[string]int{}
+		crawler.summary.Statuses = map[int]int{}
+	}
+	update(&crawler.summary)
+}
+
+// Summary returns the counts for the crawl so far.
+func (crawler *Crawler) Summary() Summary {
+	crawler.mu.Lock()
+	defer crawler.mu.Unlock()
+	s := crawler.summary
+	s.Errors = maps.Clone(crawler.summary.Errors)
+	s.ErrorTypes = maps.Clone(crawler.summary.ErrorTypes)
+	s.Statuses = maps.Clone(crawler.summary.Statuses)
+	s.SlowURLs = slices.Clone(crawler.summary.SlowURLs)
+	return s
+}
+
+// ExtractPage turns the main content element of a documentation page into a
+// ScrapedPage. It is shared by the crawler and the offline ingesters so that
+// crawled and imported html end up with identical sections.
+func ExtractPage(pageURL string, root *goquery.Selection) models.ScrapedPage {
+	page := models.ScrapedPage{
+		URL:       pageURL,
+		Title:     strings.TrimSpace(root.Find("h1").Text()),
+		CrawledAt: time.Now().Format(time.RFC3339),
+	}
+
+	if page.Title == "" {
+		page.Title = root.Find("title").Text()
+	}
+
+	root.Find("p, pre, h2, h3, table, ul, ol").Each(func(_ int, el *goquery.Selection) {
+		tagName := goquery.NodeName(el)
+		text := strings.TrimSpace(el.Text())
+
+		if text == "" {
+			return
+		}
+
+		// tables and lists are extracted whole, including their paragraphs
+		// and nested lists; code blocks in lists become their own sections
+		if el.ParentsFiltered("table").Length() > 0 {
+			return
+		}
+		if tagName != "pre" && el.ParentsFiltered("ul, ol").Length() > 0 {
+			return
+		}
+
+		switch tagName {
+		case "table":
+			if table := extractTable(el); table != nil {
+				page.Sections = append(page.Sections, models.PageSection{
+					Type:    "table",
+					Content: table.Render(),
+					Table:   table,
+				})
+			}
+		case "ul", "ol":
+			if list := extractList(el); list != nil {
+				page.Sections = append(page.Sections, models.PageSection{
+					Type:    "list",
+					Content: list.Render(),
+					List:    list,
+				})
+			}
+		case "pre":
+			// likely a code block
+			page.Sections = append(page.Sections, models.PageSection{
+				Type:     "code",
+				Content:  text,
+				Language: "detected",
+			})
+		case "h2", "h3":
+			page.Sections = append(page.Sections, models.PageSection{
+				Type:    "text",
+				Content: "## " + text, // header in markdown
+			})
+		default:
+			page.Sections = append(page.Sections, models.PageSection{
+				Type:    "text",
+				Content: text,
+			})
+		}
+	})
+
+	extractMetadata(&page, root)
+	page.Quality = quality.Score(page, pageSignals(root))
+	return page
+}
+
+func extractTable(el *goquery.Selection) *models.Table {
+	table := &models.Table{}
+	el.Find("tr").Each(func(_ int, tr *goquery.Selection) {
+		// rows of nested tables end up in their parent's cells
+		if tr.ParentsFiltered("table").First().Get(0) != el.Get(0) {
+			return
+		}
+		var cells []string
+		header := true
+		tr.ChildrenFiltered("th, td").Each(func(_ int, cell *goquery.Selection) {
+			cells = append(cells, cellText(cell))
+			if goquery.NodeName(cell) != "th" {
+				header = false
+			}
+		})
+		if len(cells) == 0 {
+			return
+		}
+		if header && table.Header == nil && len(table.Rows) == 0 {
+			table.Header = cells
+			return
+		}
+		table.Rows = append(table.Rows, cells)
+	})
+	if len(table.Rows) == 0 && table.Header == nil {
+		return nil
+	}
+	return table
+}
+
+func extractList(el *goquery.Selection) *models.List {
+	list := &models.List{Ordered: goquery.NodeName(el) == "ol"}
+	links := 0
+	el.Find("li").Each(func(_ int, li *goquery.Selection) {
+		// nested items are flattened into the outer list, code blocks are
+		// extracted as code sections of their own
+		item := li.Clone()
+		item.Find("ul, ol, pre").Remove()
+		text := cellText(item)
+		if text == "" {
+			return
+		}
+		if strings.TrimSpace(li.ChildrenFiltered("a").First().Text()) == text {
+			links++
+		}
+		list.Items = append(list.Items, text)
+	})
+	// lists of nothing but links are navigation (toctrees, sidebars)
+	if len(list.Items) == 0 || links == len(list.Items) {
+		return nil
+	}
+	return list
+}
+
+// cellText collapses the whitespace of a table cell or list item.
+func cellText(sel *goquery.Selection) string {
+	return strings.Join(strings.Fields(sel.Text()), " ")
 }
 
 // heuristic to remove signin pages
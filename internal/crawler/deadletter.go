@@ -0,0 +1,251 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"oss/internal/models"
+)
+
+// DeadLetter is a page that could not be saved, kept with the reason so it
+// can be replayed later.
+type DeadLetter struct {
+	Page     models.ScrapedPage `json:"page"`
+	Error    string             `json:"error"`
+	Attempts int                `json:"attempts"`
+	FailedAt string             `json:"failed_at"`
+}
+
+// DeadLetterQueue keeps failed pages as json lines in a file. A file rather
+// than a table, since the failed save is usually postgres being unreachable.
+// It is safe for concurrent use within one process.
+type DeadLetterQueue struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func NewDeadLetterQueue(path string) *DeadLetterQueue {
+	return &DeadLetterQueue{Path: path}
+}
+
+// Add appends a failed page to the queue.
+func (q *DeadLetterQueue) Add(letter DeadLetter) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return appendLetters(q.Path, []DeadLetter{letter})
+}
+
+// Load reads every queued page, those left aside by a retry that was
+// interrupted first, none if the file doesn't exist yet.
+func (q *DeadLetterQueue) Load() ([]DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	aside := letterReader{path: q.asidePath()}
+	letters, err := aside.read()
+	if err != nil {
+		return nil, err
+	}
+	r := letterReader{path: q.Path}
+	queued, err := r.read()
+	return append(letters, queued...), err
+}
+
+// asidePath is where Retry moves the queue while replaying it.
+func (q *DeadLetterQueue) asidePath() string {
+	return q.Path + ".retrying"
+}
+
+func appendLetters(path string, letters []DeadLetter) error {
+	if len(letters) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, letter := range letters {
+		if err := enc.Encode(letter); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// letterReader reads queued letters from a file and remembers how far it
+// got, so letters appended later can be picked up by reading again.
+type letterReader struct {
+	path   string
+	offset int64
+	line   int
+}
+
+// read returns the letters after the last read, none if the file doesn't
+// exist. A trailing line without a newline is still being written and is
+// left for the next read.
+func (r *letterReader) read() ([]DeadLetter, error) {
+	f, err := os.Open(r.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(r.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var letters []DeadLetter
+	br := bufio.NewReader(f)
+	for {
+		data, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return letters, nil
+		}
+		if err != nil {
+			return letters, err
+		}
+		r.offset += int64(len(data))
+		r.line++
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+		var letter DeadLetter
+		if err := json.Unmarshal(data, &letter); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", r.path, r.line, err)
+		}
+		letters = append(letters, letter)
+	}
+}
+
+// moveAside renames the queue to aside, which Retry has already replayed
+// and removed if it existed.
+func (q *DeadLetterQueue) moveAside(aside string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, err := os.Stat(aside); err == nil {
+		return fmt.Errorf("%s exists, is another retry running?", aside)
+	}
+	err := os.Rename(q.Path, aside)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+type RetryStats struct {
+	Retried int
+	Saved   int
+	Failed  int
+	// letters left alone because they reached the attempt limit
+	GaveUp int
+}
+
+// Retry replays queued pages into saver. Pages that save are removed from
+// the queue, the rest stay with their attempt count and error updated.
+// maxAttempts of 0 means no limit.
+//
+// The queue is moved aside while it is replayed so that pages added
+// meanwhile, by this or another process, go to a new file and are kept. A
+// retry that was interrupted leaves that file behind, it is replayed first.
+func (q *DeadLetterQueue) Retry(ctx context.Context, saver Saver, maxAttempts int) (RetryStats, error) {
+	var stats RetryStats
+	aside := q.asidePath()
+	if _, err := os.Stat(aside); err == nil {
+		if err := q.replay(ctx, aside, saver, maxAttempts, &stats); err != nil {
+			return stats, err
+		}
+	}
+	if err := q.moveAside(aside); err != nil {
+		return stats, err
+	}
+	return stats, q.replay(ctx, aside, saver, maxAttempts, &stats)
+}
+
+// replay retries the letters in the file aside, appends those left to the
+// queue and removes the file.
+func (q *DeadLetterQueue) replay(ctx context.Context, aside string, saver Saver, maxAttempts int, stats *RetryStats) error {
+	r := letterReader{path: aside}
+	letters, err := r.read()
+	if err != nil {
+		return err
+	}
+
+	letters = latestByURL(letters)
+	var remaining []DeadLetter
+	for i, letter := range letters {
+		if ctx.Err() != nil {
+			// keep everything not yet tried
+			remaining = append(remaining, letters[i:]...)
+			break
+		}
+		if maxAttempts > 0 && letter.Attempts >= maxAttempts {
+			stats.GaveUp++
+			remaining = append(remaining, letter)
+			continue
+		}
+
+		stats.Retried++
+		if err := saver.SavePage(ctx, letter.Page); err != nil {
+			stats.Failed++
+			letter.Attempts++
+			letter.Error = err.Error()
+			letter.FailedAt = time.Now().Format(time.RFC3339)
+			remaining = append(remaining, letter)
+			continue
+		}
+		stats.Saved++
+	}
+
+	// a writer that opened the queue just before it was moved appends to
+	// the file aside
+	late, err := r.read()
+	if err != nil {
+		return err
+	}
+	remaining = append(remaining, late...)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := appendLetters(q.Path, remaining); err != nil {
+		return err
+	}
+	return os.Remove(aside)
+}
+
+// latestByURL keeps the last letter queued for each url with the most
+// attempts of any of them. A page can be queued twice, by two crawls or by a
+// retry that died between requeueing its letters and removing its file.
+func latestByURL(letters []DeadLetter) []DeadLetter {
+	last := map[string]int{}
+	attempts := map[string]int{}
+	for i, letter := range letters {
+		last[letter.Page.URL] = i
+		attempts[letter.Page.URL] = max(attempts[letter.Page.URL], letter.Attempts)
+	}
+	var latest []DeadLetter
+	for i, letter := range letters {
+		if last[letter.Page.URL] == i {
+			letter.Attempts = attempts[letter.Page.URL]
+			latest = append(latest, letter)
+		}
+	}
+	return latest
+}
@@ -0,0 +1,149 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"oss/internal/models"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// PrintSaver is a Saver that writes pages out instead of storing them, for
+// trying extraction changes without touching postgres or elasticsearch.
+type PrintSaver struct {
+	W io.Writer
+	// Format is "json" for one page per line or "tree" for an outline of
+	// the sections
+	Format string
+
+	mu sync.Mutex
+}
+
+func NewPrintSaver(w io.Writer, format string) (*PrintSaver, error) {
+	if format != "json" && format != "tree" {
+		return nil, fmt.Errorf("unknown format %q, want json or tree", format)
+	}
+	return &PrintSaver{W: w, Format: format}, nil
+}
+
+func (p *PrintSaver) SavePage(ctx context.Context, page models.ScrapedPage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Format == "json" {
+		return json.NewEncoder(p.W).Encode(page)
+	}
+	return writeTree(p.W, page)
+}
+
+// writeTree prints a page as its metadata followed by its sections, indented
+// under the heading they belong to.
+func writeTree(w io.Writer, page models.ScrapedPage) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n  %s\n", page.Title, page.URL)
+	fmt.Fprintf(&b, "  source=%s quality=%.3f sections=%d", page.Source, page.Quality, len(page.Sections))
+	if page.LastUpdated != "" {
+		fmt.Fprintf(&b, " updated=%s", page.LastUpdated)
+	}
+	b.WriteString("\n")
+	if page.Description != "" {
+		fmt.Fprintf(&b, "  description: %s\n", page.Description)
+	}
+	if len(page.Breadcrumbs) > 0 {
+		fmt.Fprintf(&b, "  breadcrumbs: %s\n", strings.Join(page.Breadcrumbs, " > "))
+	}
+	if page.Deprecated != "" {
+		fmt.Fprintf(&b, "  deprecated: %s\n", page.Deprecated)
+	}
+
+	indent := "  "
+	for _, s := range page.Sections {
+		if s.Type == "text" && strings.HasPrefix(s.Content, "## ") {
+			fmt.Fprintf(&b, "  %s\n", s.Content)
+			indent = "    "
+			continue
+		}
+		label := s.Type
+		if s.Language != "" {
+			label += " " + s.Language
+		}
+		fmt.Fprintf(&b, "%s[%s] %s\n", indent, label, preview(s.Content, 100))
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// preview puts a section on one line, cut to n bytes.
+func preview(s string, n int) string {
+	return models.Truncate(strings.Join(strings.Fields(s), " "), n)
+}
+
+// ExtractLocation extracts a single page from a url or a saved html file,
+// the same way the crawler would. Urls are fetched with the credentials set
+// up by Authenticate.
+func (crawler *Crawler) ExtractLocation(ctx context.Context, location string) (models.ScrapedPage, error) {
+	var body io.Reader
+	pageURL := location
+	private := false
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+		if err != nil {
+			return models.ScrapedPage{}, err
+		}
+		if auth := crawler.authFor(req.URL.Hostname()); auth != nil {
+			for name, values := range auth.headers {
+				req.Header[name] = values
+			}
+			private = true
+		}
+		for _, cookie := range crawler.Collector.Cookies(location) {
+			req.AddCookie(cookie)
+		}
+		// the collector would run the page through the saving callbacks
+		client := &http.Client{Timeout: 30 * time.Second}
+		res, err := client.Do(req)
+		if err != nil {
+			return models.ScrapedPage{}, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return models.ScrapedPage{}, fmt.Errorf("fetching %s: %s", location, res.Status)
+		}
+		body = res.Body
+	} else {
+		f, err := os.Open(location)
+		if err != nil {
+			return models.ScrapedPage{}, err
+		}
+		defer f.Close()
+		body = f
+		abs, err := filepath.Abs(location)
+		if err != nil {
+			return models.ScrapedPage{}, err
+		}
+		pageURL = (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String()
+	}
+
+	doc, err := goquery.NewDocumentFromReader(body)
+	if err != nil {
+		return models.ScrapedPage{}, err
+	}
+	root := doc.Find(ContentSelector).First()
+	if root.Length() == 0 {
+		return models.ScrapedPage{}, fmt.Errorf("no element matching %q in %s", ContentSelector, location)
+	}
+	page := ExtractPage(pageURL, root)
+	page.Source = models.SourceWeb
+	page.Private = private
+	return page, nil
+}
@@ -0,0 +1,144 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"oss/internal/models"
+)
+
+// inventory lines look like
+//
+//	torch.Tensor.view py:method 1 generated/torch.Tensor.view.html#$ -
+//
+// names may contain spaces, so everything is anchored on the role field.
+var inventoryLine = regexp.MustCompile(`^(.+?)\s+(\S+):(\S+)\s+(-?\d+)\s+(\S*)\s+(.*)$`)
+
+// inventoryClient fetches remote inventories, with a timeout so a stalled
+// host can't hold up the start of a crawl.
+var inventoryClient = &http.Client{Timeout: 30 * time.Second}
+
+// LoadInventory reads a sphinx objects.inv from a url or a local path. Urls
+// in the inventory are relative to the directory it is published in, so for
+// local files base must name that directory; for remote inventories the
+// inventory's own location is used when base is empty.
+func LoadInventory(ctx context.Context, location, base string) ([]models.Symbol, error) {
+	var r io.ReadCloser
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := inventoryClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, fmt.Errorf("fetching %s: %s", location, res.Status)
+		}
+		r = res.Body
+		if base == "" {
+			base = location
+		}
+	} else {
+		f, err := os.Open(location)
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	}
+	defer r.Close()
+
+	if base != "" && !strings.HasSuffix(base, "/") && !strings.HasSuffix(base, ".inv") {
+		base += "/"
+	}
+	return ParseInventory(r, base)
+}
+
+// ParseInventory decodes a version 2 sphinx inventory: a few plain text
+// header lines followed by a zlib stream of one object per line.
+func ParseInventory(r io.Reader, base string) ([]models.Symbol, error) {
+	br := bufio.NewReader(r)
+
+	version, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading inventory header: %v", err)
+	}
+	if strings.TrimSpace(version) != "# Sphinx inventory version 2" {
+		return nil, fmt.Errorf("unsupported inventory: %q", strings.TrimSpace(version))
+	}
+
+	var project, projectVersion string
+	for i := 0; i < 3; i++ {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("reading inventory header: %v", err)
+		}
+		if v, ok := strings.CutPrefix(line, "# Project: "); ok {
+			project = strings.TrimSpace(v)
+		} else if v, ok := strings.CutPrefix(line, "# Version: "); ok {
+			projectVersion = strings.TrimSpace(v)
+		}
+	}
+
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing inventory: %v", err)
+	}
+	defer zr.Close()
+
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("invalid inventory base %q: %v", base, err)
+	}
+
+	var symbols []models.Symbol
+	sc := bufio.NewScanner(zr)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		m := inventoryLine.FindStringSubmatch(strings.TrimRight(sc.Text(), "\r"))
+		if m == nil {
+			continue
+		}
+		name, domain, role, location, display := m[1], m[2], m[3], m[5], m[6]
+		priority, _ := strconv.Atoi(m[4])
+
+		// $ and - are shorthands for the object name
+		if strings.HasSuffix(location, "$") {
+			location = strings.TrimSuffix(location, "$") + name
+		}
+		if display == "-" {
+			display = ""
+		}
+
+		ref, err := url.Parse(location)
+		if err != nil {
+			continue
+		}
+		symbols = append(symbols, models.Symbol{
+			Name:        name,
+			Domain:      domain,
+			Role:        role,
+			URL:         baseURL.ResolveReference(ref).String(),
+			DisplayName: display,
+			Project:     project,
+			Version:     projectVersion,
+			Priority:    priority,
+		})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading inventory: %v", err)
+	}
+	return symbols, nil
+}
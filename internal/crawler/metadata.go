@@ -0,0 +1,175 @@
+package crawler
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"oss/internal/models"
+	"oss/internal/quality"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var breadcrumbSelectors = []string{
+	"nav[aria-label='breadcrumb'] li",
+	"nav[aria-label='Breadcrumb'] li",
+	"[itemtype*='BreadcrumbList'] [itemprop='name']",
+	"ol.breadcrumb li",
+	"ul.breadcrumb li",
+	".breadcrumbs li",
+	"ul.wy-breadcrumbs li",
+	".bd-breadcrumbs li",
+}
+
+// "Last updated on Jan 02, 2024." as printed by sphinx and most static site
+// generators
+var lastUpdatedText = regexp.MustCompile(`(?i)last\s+(?:updated|modified)(?:\s+on)?:?\s*([A-Za-z]{3,9}\.?\s+\d{1,2},?\s+\d{4}|\d{4}-\d{2}-\d{2}|\d{1,2}\s+[A-Za-z]{3,9}\.?\s+\d{4})`)
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02",
+	"Jan 2, 2006",
+	"Jan 2 2006",
+	"January 2, 2006",
+	"January 2 2006",
+	"2 Jan 2006",
+	"2 January 2006",
+}
+
+var deprecationText = regexp.MustCompile(`(?i)^\s*deprecated\b|\bdeprecated since\b|\bis deprecated\b|\bhas been deprecated\b`)
+
+// notices past this many sections, or characters, belong to parts of the page
+// rather than the page itself
+const (
+	deprecationWindow = 3
+	deprecationOffset = 1000
+)
+
+// extractMetadata fills in the page level metadata that lives around the main
+// content: head meta tags, breadcrumbs and the "last updated" footer. root is
+// the main content element, the rest of the document is reached through it.
+func extractMetadata(page *models.ScrapedPage, root *goquery.Selection) {
+	doc := root.ParentsFiltered("html")
+	if doc.Length() == 0 {
+		doc = root
+	}
+
+	og := map[string]string{}
+	doc.Find("meta[property^='og:']").Each(func(_ int, m *goquery.Selection) {
+		prop, _ := m.Attr("property")
+		if content := strings.TrimSpace(m.AttrOr("content", "")); content != "" {
+			og[strings.TrimPrefix(prop, "og:")] = content
+		}
+	})
+	if len(og) > 0 {
+		page.OpenGraph = og
+	}
+
+	page.Description = strings.TrimSpace(doc.Find("meta[name='description']").AttrOr("content", ""))
+	if page.Description == "" {
+		page.Description = og["description"]
+	}
+
+	for _, sel := range breadcrumbSelectors {
+		var crumbs []string
+		doc.Find(sel).Each(func(_ int, el *goquery.Selection) {
+			if text := cellText(el); text != "" && text != "»" && text != "/" && text != ">" {
+				crumbs = append(crumbs, text)
+			}
+		})
+		if len(crumbs) > 0 {
+			page.Breadcrumbs = crumbs
+			break
+		}
+	}
+
+	page.LastUpdated = lastUpdated(doc)
+	page.Deprecated = deprecationNotice(page, root)
+}
+
+func lastUpdated(doc *goquery.Selection) string {
+	for _, sel := range []string{
+		"meta[property='article:modified_time']",
+		"meta[name='last-modified']",
+		"meta[itemprop='dateModified']",
+	} {
+		if d := parseDate(doc.Find(sel).AttrOr("content", "")); d != "" {
+			return d
+		}
+	}
+	if d := parseDate(doc.Find("time[itemprop='dateModified']").AttrOr("datetime", "")); d != "" {
+		return d
+	}
+
+	if m := lastUpdatedText.FindStringSubmatch(cellText(doc.Find("footer, .footer, .last-updated, .lastupdated"))); m != nil {
+		return parseDate(m[1])
+	}
+	return ""
+}
+
+// parseDate normalises the date formats docs sites print to 2006-01-02.
+func parseDate(s string) string {
+	s = strings.Join(strings.Fields(strings.ReplaceAll(s, ".", "")), " ")
+	if s == "" {
+		return ""
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("2006-01-02")
+		}
+	}
+	return ""
+}
+
+// deprecationNotice returns the notice that marks the whole page as
+// deprecated: a sphinx .deprecated block or a "Deprecated" paragraph near the
+// top of the page.
+func deprecationNotice(page *models.ScrapedPage, root *goquery.Selection) string {
+	if deprecationText.MatchString(page.Title) {
+		return page.Title
+	}
+
+	// sphinx puts deprecated directives in div.deprecated. On pages
+	// documenting many objects one of them may be deprecated, so only a
+	// notice near the top counts for the page.
+	notice := root.Find("div.deprecated, .admonition.deprecated, .deprecation").First()
+	if notice.Length() > 0 {
+		text := cellText(notice)
+		if i := strings.Index(cellText(root), text); i >= 0 && i < deprecationOffset {
+			return models.Truncate(text, 300)
+		}
+	}
+
+	for i, s := range page.Sections {
+		if i >= deprecationWindow {
+			break
+		}
+		if s.Type == "text" && deprecationText.MatchString(s.Content) {
+			return models.Truncate(s.Content, 300)
+		}
+	}
+	return ""
+}
+
+// pageSignals measures how much of the content element is links and page
+// chrome rather than documentation.
+func pageSignals(root *goquery.Selection) quality.Signals {
+	total := textLength(root)
+	if total == 0 {
+		return quality.Signals{}
+	}
+	return quality.Signals{
+		LinkDensity: float64(textLength(root.Find("a"))) / float64(total),
+		Boilerplate: float64(textLength(root.Find("nav, header, footer, aside, [role='navigation'], .headerlink, .toc"))) / float64(total),
+	}
+}
+
+func textLength(sel *goquery.Selection) int {
+	n := 0
+	sel.Each(func(_ int, el *goquery.Selection) {
+		n += len(strings.Join(strings.Fields(el.Text()), " "))
+	})
+	return n
+}
@@ -0,0 +1,86 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"time"
+
+	"oss/internal/models"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// how many of the slowest urls a summary keeps
+const slowURLCount = 10
+
+const requestStartKey = "started"
+
+func (crawler *Crawler) recordResponse(r *colly.Response) {
+	var took time.Duration
+	if started, ok := r.Ctx.GetAny(requestStartKey).(time.Time); ok {
+		took = time.Since(started)
+	}
+	crawler.record(func(s *Summary) {
+		s.Fetched++
+		s.Bytes += int64(len(r.Body))
+		s.Statuses[r.StatusCode]++
+		s.SlowURLs = addSlowURL(s.SlowURLs, models.URLTiming{
+			URL:      r.Request.URL.String(),
+			Duration: took.Milliseconds(),
+		})
+	})
+}
+
+// addSlowURL keeps the slowURLCount slowest timings, slowest first.
+func addSlowURL(slow []models.URLTiming, t models.URLTiming) []models.URLTiming {
+	if len(slow) == slowURLCount && t.Duration <= slow[len(slow)-1].Duration {
+		return slow
+	}
+	i := sort.Search(len(slow), func(i int) bool { return slow[i].Duration < t.Duration })
+	slow = append(slow, models.URLTiming{})
+	copy(slow[i+1:], slow[i:])
+	slow[i] = t
+	if len(slow) > slowURLCount {
+		slow = slow[:slowURLCount]
+	}
+	return slow
+}
+
+// errorType buckets a fetch error so runs can be compared without the
+// per-url detail in the message.
+func errorType(err error, status int) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case status >= 500:
+		return "http_5xx"
+	case status >= 400:
+		return "http_4xx"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.As(err, new(*net.OpError)):
+		return "connection"
+	}
+	return "other"
+}
+
+// CrawlRun turns the summary into the report stored for the run.
+func (s Summary) CrawlRun(source string) models.CrawlRun {
+	return models.CrawlRun{
+		Source:     source,
+		StartedAt:  s.StartedAt,
+		FinishedAt: s.FinishedAt,
+		Fetched:    s.Fetched,
+		Saved:      s.Saved,
+		Skipped:    s.Skipped,
+		Failed:     s.Failed + s.FetchErrors,
+		Bytes:      s.Bytes,
+		Statuses:   s.Statuses,
+		Errors:     s.ErrorTypes,
+		SlowURLs:   s.SlowURLs,
+	}
+}
@@ -0,0 +1,205 @@
+package crawler
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"oss/internal/models"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Frontier is the crawl queue shared by workers, see storage.Store.
+type Frontier interface {
+	Enqueue(ctx context.Context, urls []string, depth int) error
+	Claim(ctx context.Context, worker string, lease time.Duration) (*models.FrontierURL, error)
+	Complete(ctx context.Context, id int64, worker string) error
+	Fail(ctx context.Context, id int64, worker, reason string, maxAttempts int) error
+	Outstanding(ctx context.Context) (int, error)
+	Heartbeat(ctx context.Context, w models.Worker, lease time.Duration) error
+	Release(ctx context.Context, worker string) error
+}
+
+type WorkerOptions struct {
+	// ID must be unique among running workers
+	ID   string
+	Host string
+	// Concurrency is the number of urls fetched at once
+	Concurrency int
+	// Lease is how long a claimed url stays with this worker without a
+	// heartbeat
+	Lease time.Duration
+	// MaxDepth stops following links this many hops from a start url, 0
+	// for no limit
+	MaxDepth int
+	// MaxAttempts gives up on urls that failed this often
+	MaxAttempts int
+	// Poll is how long to wait when nothing can be claimed
+	Poll time.Duration
+	// ExitWhenIdle returns once the frontier has nothing left, rather than
+	// waiting for more urls
+	ExitWhenIdle bool
+}
+
+const linksKey = "links"
+
+// Work crawls urls claimed from the frontier until ctx is cancelled, or the
+// frontier is drained with ExitWhenIdle. Discovered links go back to the
+// frontier for any worker to pick up. Politeness delays are enforced by the
+// frontier, not by the collector.
+func (crawler *Crawler) Work(ctx context.Context, frontier Frontier, opts WorkerOptions) error {
+	crawler.Collector.Async = false
+	crawler.Collector.AllowURLRevisit = true
+
+	crawler.record(func(s *Summary) { s.StartedAt = time.Now() })
+	crawler.handlePages(func(e *colly.HTMLElement, link string) {
+		if links, ok := e.Request.Ctx.GetAny(linksKey).(*[]string); ok {
+			*links = append(*links, link)
+		}
+	})
+
+	state := &workerState{Worker: models.Worker{ID: opts.ID, Host: opts.Host, StartedAt: time.Now()}}
+	if err := frontier.Heartbeat(ctx, state.snapshot(), opts.Lease); err != nil {
+		return err
+	}
+
+	hbCtx, stopHeartbeat := context.WithCancel(ctx)
+	defer stopHeartbeat()
+	go func() {
+		ticker := time.NewTicker(opts.Lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-hbCtx.Done():
+				return
+			case <-ticker.C:
+				if err := frontier.Heartbeat(hbCtx, state.snapshot(), opts.Lease); err != nil && hbCtx.Err() == nil {
+					log.Printf("heartbeat failed: %v\n", err)
+				}
+			}
+		}
+	}()
+
+	stopFlushing := crawler.flushEvery(flushInterval)
+	defer stopFlushing()
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			crawler.workLoop(ctx, frontier, opts, state)
+		}()
+	}
+	wg.Wait()
+	stopHeartbeat()
+	stopFlushing()
+	crawler.Flush()
+
+	crawler.record(func(s *Summary) { s.FinishedAt = time.Now() })
+	// ctx may be done already, releasing must still happen
+	return frontier.Release(context.Background(), opts.ID)
+}
+
+func (crawler *Crawler) workLoop(ctx context.Context, frontier Frontier, opts WorkerOptions, state *workerState) {
+	for ctx.Err() == nil {
+		next, err := frontier.Claim(ctx, opts.ID, opts.Lease)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("failed to claim url: %v\n", err)
+			}
+			sleep(ctx, opts.Poll)
+			continue
+		}
+		if next == nil {
+			// nothing to fetch, don't hold pages back waiting for a full batch
+			crawler.Flush()
+			if opts.ExitWhenIdle {
+				if n, err := frontier.Outstanding(ctx); err == nil && n == 0 {
+					return
+				}
+			}
+			sleep(ctx, opts.Poll)
+			continue
+		}
+
+		state.start(next.URL)
+		links, err := crawler.fetch(next.URL)
+		state.finish()
+		if err != nil {
+			if err := frontier.Fail(ctx, next.ID, opts.ID, err.Error(), opts.MaxAttempts); err != nil {
+				log.Printf("failed to return %s to the frontier: %v\n", next.URL, err)
+			}
+			continue
+		}
+		if opts.MaxDepth == 0 || next.Depth < opts.MaxDepth {
+			if err := frontier.Enqueue(ctx, links, next.Depth+1); err != nil {
+				log.Printf("failed to queue links from %s: %v\n", next.URL, err)
+			}
+		}
+		if err := frontier.Complete(ctx, next.ID, opts.ID); err != nil {
+			log.Printf("failed to complete %s: %v\n", next.URL, err)
+		}
+	}
+}
+
+// fetch visits one url and returns the links found on it, without
+// fragments.
+func (crawler *Crawler) fetch(pageURL string) ([]string, error) {
+	var links []string
+	ctx := colly.NewContext()
+	ctx.Put(linksKey, &links)
+	if err := crawler.Collector.Request("GET", pageURL, nil, ctx, nil); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var out []string
+	for _, link := range links {
+		u, err := url.Parse(link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		u.Fragment = ""
+		if s := u.String(); !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+// workerState is what the heartbeat reports.
+type workerState struct {
+	mu sync.Mutex
+	models.Worker
+}
+
+func (w *workerState) start(url string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.CurrentURL = url
+}
+
+func (w *workerState) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.CurrentURL = ""
+	w.Fetched++
+}
+
+func (w *workerState) snapshot() models.Worker {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.Worker
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,446 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"oss/internal/crawler"
+	"oss/internal/models"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var docExts = []string{".md", ".markdown", ".rst", ".html", ".htm"}
+
+// DirSource reads Markdown, reStructuredText and HTML files from a local
+// directory, typically a checked out docs folder that is never published.
+type DirSource struct {
+	Root    string
+	BaseURL string
+}
+
+func (d *DirSource) Walk(ctx context.Context, fn func(models.ScrapedPage) error) error {
+	return walkFiles(ctx, d.Root, docExts, func(path, rel string) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		u, err := pageURL(d.BaseURL, d.Root, rel)
+		if err != nil {
+			return err
+		}
+
+		page, err := ParseDoc(u, filepath.Ext(path), data)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %v", rel, err)
+		}
+		if page.Title == "" {
+			page.Title = strings.TrimSuffix(filepath.Base(rel), filepath.Ext(rel))
+		}
+		page.Source = models.SourceDocs
+		return fn(page)
+	})
+}
+
+// ParseDoc converts a single document into a page, picking the parser from
+// the file extension.
+func ParseDoc(pageURL, ext string, data []byte) (models.ScrapedPage, error) {
+	switch strings.ToLower(ext) {
+	case ".md", ".markdown":
+		return parseMarkdown(pageURL, data), nil
+	case ".rst":
+		return parseRST(pageURL, data), nil
+	case ".html", ".htm":
+		return parseHTML(pageURL, data)
+	}
+	return models.ScrapedPage{}, fmt.Errorf("unsupported document type %q", ext)
+}
+
+func parseHTML(pageURL string, data []byte) (models.ScrapedPage, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	if err != nil {
+		return models.ScrapedPage{}, err
+	}
+	root := doc.Find(crawler.ContentSelector).First()
+	if root.Length() == 0 {
+		root = doc.Find("body")
+	}
+	page := crawler.ExtractPage(pageURL, root)
+	if page.Title == "" {
+		page.Title = strings.TrimSpace(doc.Find("title").Text())
+	}
+	return page, nil
+}
+
+// docBuilder accumulates sections while a parser walks a document line by
+// line. Headings are stored the same way the crawler stores h2/h3.
+type docBuilder struct {
+	page models.ScrapedPage
+	para []string
+}
+
+func newDocBuilder(pageURL string) *docBuilder {
+	return &docBuilder{page: models.ScrapedPage{
+		URL:       pageURL,
+		CrawledAt: time.Now().Format(time.RFC3339),
+	}}
+}
+
+func (b *docBuilder) text(line string) {
+	b.para = append(b.para, strings.TrimSpace(line))
+}
+
+func (b *docBuilder) flush() {
+	if len(b.para) == 0 {
+		return
+	}
+	content := strings.TrimSpace(strings.Join(b.para, " "))
+	b.para = nil
+	if content == "" {
+		return
+	}
+	b.page.Sections = append(b.page.Sections, models.PageSection{
+		Type:    "text",
+		Content: content,
+	})
+}
+
+func (b *docBuilder) heading(level int, text string) {
+	b.flush()
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	// the first top level heading names the page
+	if level == 1 && b.page.Title == "" {
+		b.page.Title = text
+		return
+	}
+	b.page.Sections = append(b.page.Sections, models.PageSection{
+		Type:    "text",
+		Content: "## " + text,
+	})
+}
+
+func (b *docBuilder) code(lang string, lines []string) {
+	b.flush()
+	content := strings.Trim(dedent(lines), "\n")
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+	b.page.Sections = append(b.page.Sections, models.PageSection{
+		Type:     "code",
+		Content:  content,
+		Language: strings.ToLower(lang),
+	})
+}
+
+func (b *docBuilder) done() models.ScrapedPage {
+	b.flush()
+	return b.page
+}
+
+func splitLines(data []byte) []string {
+	var lines []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		lines = append(lines, strings.TrimRight(sc.Text(), " \t\r"))
+	}
+	return lines
+}
+
+// dedent strips the indentation shared by every non blank line.
+func dedent(lines []string) string {
+	indent := -1
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		n := len(l) - len(strings.TrimLeft(l, " \t"))
+		if indent == -1 || n < indent {
+			indent = n
+		}
+	}
+	var out strings.Builder
+	for _, l := range lines {
+		if len(l) >= indent && indent > 0 {
+			l = l[indent:]
+		}
+		out.WriteString(l + "\n")
+	}
+	return out.String()
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+func parseMarkdown(pageURL string, data []byte) models.ScrapedPage {
+	b := newDocBuilder(pageURL)
+	lines := splitLines(data)
+	i := 0
+
+	// yaml front matter, only the title is of interest
+	if len(lines) > 0 && lines[0] == "---" {
+		for j := 1; j < len(lines); j++ {
+			if lines[j] == "---" || lines[j] == "..." {
+				i = j + 1
+				break
+			}
+			if v, ok := strings.CutPrefix(lines[j], "title:"); ok {
+				b.page.Title = strings.Trim(strings.TrimSpace(v), `"'`)
+			}
+		}
+	}
+
+	b.markdown(lines[i:])
+	return b.done()
+}
+
+// markdown appends the sections of a markdown fragment to the page.
+func (b *docBuilder) markdown(lines []string) {
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		// fenced code blocks: ```lang or ~~~lang
+		if fence := codeFence(trimmed); fence != "" {
+			b.flush()
+			lang := strings.Fields(strings.TrimLeft(trimmed, fence[:1]) + " ")
+			var body []string
+			for i++; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+					break
+				}
+				body = append(body, lines[i])
+			}
+			if len(lang) > 0 {
+				b.code(strings.Trim(lang[0], "{}."), body)
+			} else {
+				b.code("", body)
+			}
+			continue
+		}
+
+		if trimmed == "" {
+			b.flush()
+			continue
+		}
+
+		// atx headings
+		if strings.HasPrefix(trimmed, "#") {
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+			if level <= 6 && (len(trimmed) == level || trimmed[level] == ' ') {
+				b.heading(level, strings.TrimRight(trimmed[level:], "# "))
+				continue
+			}
+		}
+
+		// setext headings, the underline follows a single paragraph line
+		if len(b.para) == 0 && i+1 < len(lines) {
+			next := strings.TrimSpace(lines[i+1])
+			if next != "" && strings.Trim(next, "=") == "" {
+				b.heading(1, trimmed)
+				i++
+				continue
+			}
+			if len(next) >= 2 && strings.Trim(next, "-") == "" {
+				b.heading(2, trimmed)
+				i++
+				continue
+			}
+		}
+
+		// indented code only starts after a blank line
+		if len(b.para) == 0 && indentOf(line) >= 4 && !isListItem(trimmed) {
+			var body []string
+			for ; i < len(lines); i++ {
+				if strings.TrimSpace(lines[i]) != "" && indentOf(lines[i]) < 4 {
+					break
+				}
+				body = append(body, lines[i])
+			}
+			i--
+			b.code("", body)
+			continue
+		}
+
+		// html comments and thematic breaks carry no content
+		if strings.HasPrefix(trimmed, "<!--") || trimmed == "---" || trimmed == "***" {
+			continue
+		}
+
+		// keep list items as separate sections so they don't run together
+		if isListItem(trimmed) {
+			b.flush()
+		}
+		b.text(trimmed)
+	}
+	b.flush()
+}
+
+func codeFence(trimmed string) string {
+	for _, f := range []string{"```", "~~~"} {
+		if strings.HasPrefix(trimmed, f) {
+			n := len(trimmed) - len(strings.TrimLeft(trimmed, f[:1]))
+			return strings.Repeat(f[:1], n)
+		}
+	}
+	return ""
+}
+
+func isListItem(trimmed string) bool {
+	if strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* ") || strings.HasPrefix(trimmed, "+ ") {
+		return true
+	}
+	digits := len(trimmed) - len(strings.TrimLeft(trimmed, "0123456789"))
+	return digits > 0 && digits < len(trimmed)-1 &&
+		(trimmed[digits] == '.' || trimmed[digits] == ')') && trimmed[digits+1] == ' '
+}
+
+// rstAdornment reports whether line is a section underline/overline.
+func rstAdornment(line string) bool {
+	if len(line) < 2 {
+		return false
+	}
+	c := line[0]
+	if !strings.ContainsRune(`=-~^"'`+"`"+`#*+:._`, rune(c)) {
+		return false
+	}
+	return strings.Trim(line, string(c)) == ""
+}
+
+func parseRST(pageURL string, data []byte) models.ScrapedPage {
+	b := newDocBuilder(pageURL)
+	lines := splitLines(data)
+	// rst has no fixed heading characters, the order they first appear in
+	// decides the level
+	var levels []string
+	levelOf := func(style string) int {
+		for i, s := range levels {
+			if s == style {
+				return i + 1
+			}
+		}
+		levels = append(levels, style)
+		return len(levels)
+	}
+
+	// indentedBlock collects the lines indented deeper than the directive
+	// or paragraph at position i, returning them and the last line consumed.
+	indentedBlock := func(i, base int) ([]string, int) {
+		var body []string
+		j := i + 1
+		for ; j < len(lines); j++ {
+			if strings.TrimSpace(lines[j]) != "" && indentOf(lines[j]) <= base {
+				break
+			}
+			body = append(body, lines[j])
+		}
+		return body, j - 1
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if trimmed == "" {
+			b.flush()
+			continue
+		}
+
+		// overlined title: ====, text, ====
+		if rstAdornment(trimmed) && i+2 < len(lines) && strings.TrimSpace(lines[i+2]) == trimmed &&
+			strings.TrimSpace(lines[i+1]) != "" {
+			b.heading(levelOf("o"+trimmed[:1]), lines[i+1])
+			i += 2
+			continue
+		}
+
+		// underlined title
+		if len(b.para) == 0 && i+1 < len(lines) && indentOf(line) == 0 {
+			next := lines[i+1]
+			if rstAdornment(next) && len(next) >= len(trimmed) {
+				b.heading(levelOf("u"+next[:1]), trimmed)
+				i++
+				continue
+			}
+		}
+
+		if strings.HasPrefix(trimmed, "..") {
+			b.flush()
+			base := indentOf(line)
+			body, end := indentedBlock(i, base)
+			i = end
+
+			directive := strings.TrimSpace(strings.TrimPrefix(trimmed, ".."))
+			name, arg, isDirective := strings.Cut(directive, "::")
+			if !isDirective {
+				// comment or hyperlink target
+				continue
+			}
+			switch strings.TrimSpace(name) {
+			case "code-block", "code", "sourcecode", "literalinclude":
+				b.code(strings.TrimSpace(arg), stripOptions(body))
+			case "image", "figure", "toctree", "include", "raw", "highlight", "currentmodule", "module", "automodule", "autosummary":
+				// nothing searchable
+			default:
+				// admonitions and friends: keep their argument and body as text
+				if a := strings.TrimSpace(arg); a != "" {
+					b.text(a)
+				}
+				for _, l := range stripOptions(body) {
+					if strings.TrimSpace(l) == "" {
+						b.flush()
+						continue
+					}
+					b.text(l)
+				}
+				b.flush()
+			}
+			continue
+		}
+
+		// a paragraph ending in :: introduces a literal block
+		if strings.HasSuffix(trimmed, "::") {
+			text := strings.TrimSuffix(trimmed, ":")
+			if text == ":" {
+				text = ""
+			} else if strings.HasSuffix(text, " :") {
+				text = strings.TrimSuffix(text, " :")
+			}
+			if text != "" {
+				b.text(text)
+			}
+			body, end := indentedBlock(i, indentOf(line))
+			i = end
+			b.code("", body)
+			continue
+		}
+
+		if isListItem(trimmed) {
+			b.flush()
+		}
+		b.text(trimmed)
+	}
+	return b.done()
+}
+
+// stripOptions drops the :option: lines that follow a directive.
+func stripOptions(body []string) []string {
+	i := 0
+	for i < len(body) && strings.TrimSpace(body[i]) == "" {
+		i++
+	}
+	for i < len(body) && strings.HasPrefix(strings.TrimSpace(body[i]), ":") {
+		i++
+	}
+	return body[i:]
+}
@@ -0,0 +1,203 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"oss/internal/models"
+
+	_ "modernc.org/sqlite"
+)
+
+// DocsetSource imports a Dash/Zeal docset bundle: the html under
+// Contents/Resources/Documents goes through the same extraction as crawled
+// pages, and the docSet.dsidx search index becomes symbols.
+type DocsetSource struct {
+	Root string
+	// BaseURL is where the Documents directory is published online, if
+	// anywhere; file:// urls are used otherwise.
+	BaseURL string
+
+	symbols []models.Symbol
+}
+
+func (d *DocsetSource) docsDir() string {
+	return filepath.Join(d.Root, "Contents", "Resources", "Documents")
+}
+
+func (d *DocsetSource) Symbols() []models.Symbol {
+	return d.symbols
+}
+
+func (d *DocsetSource) Walk(ctx context.Context, fn func(models.ScrapedPage) error) error {
+	info, err := readDocsetInfo(filepath.Join(d.Root, "Contents", "Info.plist"))
+	if err != nil {
+		return fmt.Errorf("not a docset: %v", err)
+	}
+
+	symbols, err := d.readIndex(ctx, info)
+	if err != nil {
+		return fmt.Errorf("failed to read docset index: %v", err)
+	}
+	d.symbols = symbols
+
+	pages := &DirSource{Root: d.docsDir(), BaseURL: d.BaseURL}
+	return pages.Walk(ctx, func(p models.ScrapedPage) error {
+		p.Source = models.SourceDocset
+		p.Tags = []string{info.Name}
+		return fn(p)
+	})
+}
+
+type docsetInfo struct {
+	Name     string
+	Platform string
+}
+
+// readDocsetInfo pulls the bundle name and platform family out of the
+// Info.plist, a flat <key>/<value> dictionary.
+func readDocsetInfo(path string) (docsetInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return docsetInfo{}, err
+	}
+	defer f.Close()
+
+	var info docsetInfo
+	var key string
+	dec := xml.NewDecoder(f)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return docsetInfo{}, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		var value string
+		switch start.Name.Local {
+		case "key":
+			if err := dec.DecodeElement(&key, &start); err != nil {
+				return docsetInfo{}, err
+			}
+			continue
+		case "string":
+			if err := dec.DecodeElement(&value, &start); err != nil {
+				return docsetInfo{}, err
+			}
+		default:
+			continue
+		}
+		switch key {
+		case "CFBundleName":
+			info.Name = value
+		case "DocSetPlatformFamily":
+			info.Platform = value
+		}
+	}
+	if info.Platform == "" {
+		info.Platform = "dash"
+	}
+	return info, nil
+}
+
+// dash annotates some paths with <dash_entry_...> metadata
+var dashEntryTag = regexp.MustCompile(`<dash_entry_[^>]*>`)
+
+// readIndex loads the search index. Dash generated docsets use a plain
+// searchIndex table, apple style ones the core data ZTOKEN tables.
+func (d *DocsetSource) readIndex(ctx context.Context, info docsetInfo) ([]models.Symbol, error) {
+	index := filepath.Join(d.Root, "Contents", "Resources", "docSet.dsidx")
+	if _, err := os.Stat(index); err != nil {
+		return nil, err
+	}
+	// escaped, a ? or # in the path would start the dsn's options, and
+	// absolute, a relative path would be taken as the url's host
+	abs, err := filepath.Abs(index)
+	if err != nil {
+		return nil, err
+	}
+	dsn := (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs), RawQuery: "mode=ro"}).String()
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var n int
+	err = db.QueryRowContext(ctx, `SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'searchIndex'`).Scan(&n)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT name, type, path FROM searchIndex`
+	if n == 0 {
+		query = `
+			SELECT t.ZTOKENNAME, ty.ZTYPENAME,
+				f.ZPATH || COALESCE('#' || NULLIF(m.ZANCHOR, ''), '')
+			FROM ZTOKEN t
+			JOIN ZTOKENTYPE ty ON t.ZTOKENTYPE = ty.Z_PK
+			JOIN ZTOKENMETAINFORMATION m ON t.ZMETAINFORMATION = m.Z_PK
+			JOIN ZFILEPATH f ON m.ZFILE = f.Z_PK
+		`
+	}
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var symbols []models.Symbol
+	for rows.Next() {
+		var name, typ, path string
+		if err := rows.Scan(&name, &typ, &path); err != nil {
+			return nil, err
+		}
+		u, err := d.symbolURL(dashEntryTag.ReplaceAllString(path, ""))
+		if err != nil {
+			continue
+		}
+		symbols = append(symbols, models.Symbol{
+			Name:     name,
+			Domain:   strings.ToLower(info.Platform),
+			Role:     strings.ToLower(typ),
+			URL:      u,
+			Project:  info.Name,
+			Priority: 1,
+		})
+	}
+	return symbols, rows.Err()
+}
+
+// symbolURL maps an index path (relative to Documents, possibly with an
+// anchor) onto the same url scheme as the imported pages.
+func (d *DocsetSource) symbolURL(path string) (string, error) {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path, nil
+	}
+	file, anchor, _ := strings.Cut(path, "#")
+	if file == "" {
+		return "", fmt.Errorf("empty path")
+	}
+	u, err := pageURL(d.BaseURL, d.docsDir(), file)
+	if err != nil {
+		return "", err
+	}
+	if anchor != "" {
+		u += "#" + url.PathEscape(anchor)
+	}
+	return u, nil
+}
@@ -0,0 +1,309 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/doc"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"oss/internal/models"
+)
+
+// GoSource loads the packages of a go module from a local directory (a
+// checkout or a directory in the module cache) and emits one page per
+// package, with symbols for every exported identifier.
+type GoSource struct {
+	Root string
+	// BaseURL is joined with the import path, pkg.go.dev style
+	BaseURL string
+	// ModulePath overrides the module path read from Root/go.mod
+	ModulePath string
+
+	symbols []models.Symbol
+}
+
+func (g *GoSource) Symbols() []models.Symbol {
+	return g.symbols
+}
+
+func (g *GoSource) Walk(ctx context.Context, fn func(models.ScrapedPage) error) error {
+	modPath := g.ModulePath
+	if modPath == "" {
+		var err error
+		modPath, err = readModulePath(filepath.Join(g.Root, "go.mod"))
+		if err != nil {
+			return err
+		}
+	}
+	base := g.BaseURL
+	if base == "" {
+		base = "https://pkg.go.dev"
+	}
+
+	return filepath.WalkDir(g.Root, func(dir string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		name := d.Name()
+		if dir != g.Root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") ||
+			name == "testdata" || name == "vendor") {
+			return filepath.SkipDir
+		}
+		// nested modules are separate modules
+		if dir != g.Root {
+			if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+
+		rel, err := filepath.Rel(g.Root, dir)
+		if err != nil {
+			return err
+		}
+		importPath := path.Join(modPath, filepath.ToSlash(rel))
+
+		page, symbols, err := loadGoPackage(dir, importPath, strings.TrimSuffix(base, "/")+"/"+importPath)
+		if err != nil {
+			var noGo *build.NoGoError
+			if errors.As(err, &noGo) {
+				return nil
+			}
+			return fmt.Errorf("failed to load %s: %v", importPath, err)
+		}
+		g.symbols = append(g.symbols, symbols...)
+		return fn(page)
+	})
+}
+
+func readModulePath(gomod string) (string, error) {
+	f, err := os.Open(gomod)
+	if err != nil {
+		return "", fmt.Errorf("no module path: %v", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(sc.Text()), "module "); ok {
+			return strings.Trim(strings.TrimSpace(v), `"`), nil
+		}
+	}
+	return "", fmt.Errorf("no module directive in %s", gomod)
+}
+
+// loadGoPackage parses the package in dir, honouring build constraints for
+// the host platform, and renders its documentation.
+func loadGoPackage(dir, importPath, pageURL string) (models.ScrapedPage, []models.Symbol, error) {
+	bp, err := build.Default.ImportDir(dir, build.ImportComment)
+	if err != nil {
+		return models.ScrapedPage{}, nil, err
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	names := append(append(append([]string{}, bp.GoFiles...), bp.CgoFiles...), bp.TestGoFiles...)
+	names = append(names, bp.XTestGoFiles...)
+	for _, name := range names {
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return models.ScrapedPage{}, nil, err
+		}
+		files = append(files, f)
+	}
+
+	pkg, err := doc.NewFromFiles(fset, files, importPath)
+	if err != nil {
+		return models.ScrapedPage{}, nil, err
+	}
+
+	r := goDocRenderer{
+		fset:       fset,
+		pkg:        pkg,
+		importPath: importPath,
+		pageURL:    pageURL,
+		page: models.ScrapedPage{
+			URL:       pageURL,
+			Title:     "package " + pkg.Name + " (" + importPath + ")",
+			CrawledAt: time.Now().Format(time.RFC3339),
+			Source:    models.SourceGoDoc,
+		},
+	}
+	r.render()
+	return r.page, r.symbols, nil
+}
+
+type goDocRenderer struct {
+	fset       *token.FileSet
+	pkg        *doc.Package
+	importPath string
+	pageURL    string
+	page       models.ScrapedPage
+	symbols    []models.Symbol
+}
+
+func (r *goDocRenderer) render() {
+	r.symbol(r.importPath, "package", "")
+	r.text(r.pkg.Doc)
+	r.examples(r.pkg.Examples, "")
+
+	r.values(r.pkg.Consts, "const")
+	r.values(r.pkg.Vars, "var")
+
+	for _, f := range r.pkg.Funcs {
+		r.function(f, "")
+	}
+
+	for _, t := range r.pkg.Types {
+		r.heading("type " + t.Name)
+		r.symbol(t.Name, "type", t.Name)
+		r.text(t.Doc)
+		r.code(t.Decl)
+		r.examples(t.Examples, t.Name)
+
+		r.values(t.Consts, "const")
+		r.values(t.Vars, "var")
+		for _, f := range t.Funcs {
+			r.function(f, "")
+		}
+		for _, m := range t.Methods {
+			r.function(m, t.Name)
+		}
+	}
+}
+
+// symbol records an identifier, anchored the way pkg.go.dev anchors them.
+func (r *goDocRenderer) symbol(name, role, anchor string) {
+	s := models.Symbol{
+		Name:     r.importPath,
+		Domain:   "go",
+		Role:     role,
+		URL:      r.pageURL,
+		Priority: 1,
+	}
+	if anchor != "" {
+		s.Name = r.importPath + "." + name
+		s.URL = r.pageURL + "#" + anchor
+		s.DisplayName = name
+	}
+	r.symbols = append(r.symbols, s)
+}
+
+func (r *goDocRenderer) function(f *doc.Func, recv string) {
+	name, anchor, role := f.Name, f.Name, "func"
+	if recv != "" {
+		name = recv + "." + f.Name
+		anchor = name
+		role = "method"
+		r.heading("func (" + f.Recv + ") " + f.Name)
+	} else {
+		r.heading("func " + f.Name)
+	}
+	r.symbol(name, role, anchor)
+	r.text(f.Doc)
+
+	// only the signature is documentation
+	decl := *f.Decl
+	decl.Body = nil
+	decl.Doc = nil
+	r.code(&decl)
+	r.examples(f.Examples, name)
+}
+
+func (r *goDocRenderer) values(values []*doc.Value, role string) {
+	for _, v := range values {
+		for _, name := range v.Names {
+			if ast.IsExported(name) {
+				r.symbol(name, role, name)
+			}
+		}
+		r.text(v.Doc)
+		r.code(v.Decl)
+	}
+}
+
+func (r *goDocRenderer) examples(examples []*doc.Example, parent string) {
+	for _, ex := range examples {
+		title := "Example"
+		if parent != "" {
+			title += " " + parent
+		}
+		if ex.Suffix != "" {
+			title += " (" + ex.Suffix + ")"
+		}
+		r.heading(title)
+		r.text(ex.Doc)
+
+		var node ast.Node = ex.Code
+		if ex.Play != nil {
+			node = ex.Play
+		}
+		r.code(node)
+		if out := strings.TrimSpace(ex.Output); out != "" {
+			r.text("Output:\n" + out)
+		}
+	}
+}
+
+func (r *goDocRenderer) heading(text string) {
+	r.page.Sections = append(r.page.Sections, models.PageSection{
+		Type:    "text",
+		Content: "## " + text,
+	})
+}
+
+func (r *goDocRenderer) text(text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	r.page.Sections = append(r.page.Sections, models.PageSection{
+		Type:    "text",
+		Content: text,
+	})
+}
+
+func (r *goDocRenderer) code(node ast.Node) {
+	if node == nil {
+		return
+	}
+	var buf bytes.Buffer
+	// example bodies are block statements, print their contents only
+	if block, ok := node.(*ast.BlockStmt); ok {
+		for _, stmt := range block.List {
+			if err := format.Node(&buf, r.fset, stmt); err != nil {
+				return
+			}
+			buf.WriteString("\n")
+		}
+	} else if err := format.Node(&buf, r.fset, node); err != nil {
+		return
+	}
+	content := strings.TrimSpace(buf.String())
+	if content == "" {
+		return
+	}
+	r.page.Sections = append(r.page.Sections, models.PageSection{
+		Type:     "code",
+		Content:  content,
+		Language: "go",
+	})
+}
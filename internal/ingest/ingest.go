@@ -0,0 +1,166 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"oss/internal/crawler"
+	"oss/internal/models"
+)
+
+// Source produces pages from somewhere other than the live web, e.g. a
+// directory of markdown files. Walk calls fn once per page, in a stable order.
+type Source interface {
+	Walk(ctx context.Context, fn func(models.ScrapedPage) error) error
+}
+
+// SymbolSource is implemented by sources that also build a symbol table
+// while walking. Symbols are read once Walk has returned.
+type SymbolSource interface {
+	Symbols() []models.Symbol
+}
+
+type SymbolSaver interface {
+	SaveSymbols(ctx context.Context, symbols []models.Symbol) error
+}
+
+type Stats struct {
+	Pages   int
+	Saved   int
+	Failed  int
+	Skipped int
+	Symbols int
+}
+
+// Run feeds every page from src into saver. Save failures are logged and
+// counted rather than aborting the import, the same way the crawler treats them.
+// Pages are saved crawler.DefaultBatchSize at a time when saver is a
+// crawler.BatchSaver. Symbols are saved too when both src and saver support
+// them.
+func Run(ctx context.Context, src Source, saver crawler.Saver) (Stats, error) {
+	var stats Stats
+	saved := func(p models.ScrapedPage, err error) {
+		if err != nil {
+			log.Printf("failed to save page %s: %v\n", p.URL, err)
+			stats.Failed++
+			return
+		}
+		stats.Saved++
+	}
+	batchSaver, batched := saver.(crawler.BatchSaver)
+	var batch []models.ScrapedPage
+	// pages already read are saved even once ctx is cancelled, e.g. on ctrl-c
+	flushCtx := context.WithoutCancel(ctx)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		for i, err := range batchSaver.SavePages(flushCtx, batch) {
+			saved(batch[i], err)
+		}
+		batch = batch[:0]
+	}
+
+	err := src.Walk(ctx, func(p models.ScrapedPage) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		stats.Pages++
+		if len(p.Sections) == 0 {
+			stats.Skipped++
+			return nil
+		}
+		if !batched {
+			saved(p, saver.SavePage(ctx, p))
+			return nil
+		}
+		batch = append(batch, p)
+		if len(batch) >= crawler.DefaultBatchSize {
+			flush()
+		}
+		return nil
+	})
+	flush()
+	if err != nil {
+		return stats, err
+	}
+
+	symSrc, ok := src.(SymbolSource)
+	if !ok {
+		return stats, nil
+	}
+	symSaver, ok := saver.(SymbolSaver)
+	if !ok {
+		return stats, nil
+	}
+	symbols := symSrc.Symbols()
+	if len(symbols) == 0 {
+		return stats, nil
+	}
+	if err := symSaver.SaveSymbols(ctx, symbols); err != nil {
+		return stats, fmt.Errorf("failed to save symbols: %v", err)
+	}
+	stats.Symbols = len(symbols)
+	return stats, nil
+}
+
+// walkFiles calls fn for every regular file under root whose extension is
+// in exts, passing the path relative to root in slash form. Hidden
+// directories (.git, .venv, ...) are skipped.
+func walkFiles(ctx context.Context, root string, exts []string, fn func(path, rel string) error) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !hasExt(path, exts) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		return fn(path, filepath.ToSlash(rel))
+	})
+}
+
+func hasExt(path string, exts []string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range exts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// pageURL joins a slash separated relative path onto base. When base is empty
+// the file:// url of the file under root is used instead, so urls stay stable
+// across runs either way.
+func pageURL(base, root, rel string) (string, error) {
+	if base == "" {
+		abs, err := filepath.Abs(filepath.Join(root, filepath.FromSlash(rel)))
+		if err != nil {
+			return "", err
+		}
+		return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String(), nil
+	}
+	u, err := url.Parse(strings.TrimSuffix(base, "/") + "/")
+	if err != nil {
+		return "", fmt.Errorf("invalid base url %q: %v", base, err)
+	}
+	return u.JoinPath(rel).String(), nil
+}
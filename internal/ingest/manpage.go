@@ -0,0 +1,416 @@
+package ingest
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"oss/internal/models"
+)
+
+// ManSource reads troff man pages (man(7) and the common parts of mdoc(7)),
+// plain or gzip/bzip2 compressed, e.g. from /usr/share/man. Pages are stored
+// under man:name(section) urls. Below Root only man* directories are read,
+// which skips the translated copies in locale directories. Aliases, whether
+// symlinks or .so files, are left out, the page they point to is read once.
+type ManSource struct {
+	Root string
+}
+
+// ls.1.gz, printf.3p, openssl-x509.1ssl.bz2
+var manFileName = regexp.MustCompile(`^(.+)\.([1-9n][a-z0-9]*)(\.gz|\.bz2)?$`)
+
+func (m *ManSource) Walk(ctx context.Context, fn func(models.ScrapedPage) error) error {
+	// resolved paths of the pages read, a symlinked alias is named after the
+	// page it links to by its .TH
+	seen := map[string]bool{}
+	return filepath.WalkDir(m.Root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != m.Root && !strings.HasPrefix(d.Name(), "man") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		match := manFileName.FindStringSubmatch(d.Name())
+		if match == nil {
+			return nil
+		}
+		// man trees link aliases to the page documenting them
+		if d.Type()&fs.ModeSymlink != 0 {
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+		} else if !d.Type().IsRegular() {
+			return nil
+		}
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil || seen[resolved] {
+			return nil
+		}
+		seen[resolved] = true
+
+		data, err := readMaybeCompressed(path, match[3])
+		if err != nil {
+			// one broken page shouldn't stop the import
+			log.Printf("skipping man page %s: %v\n", path, err)
+			return nil
+		}
+		if isManAlias(data) {
+			return nil
+		}
+		page := ParseManPage(match[1], match[2], data)
+		return fn(page)
+	})
+}
+
+// isManAlias reports whether a page only sources another, the way man trees
+// ship most aliases: a single ".so man1/foo.1" line.
+func isManAlias(data []byte) bool {
+	alias := false
+	for _, line := range splitLines(data) {
+		switch {
+		case strings.TrimSpace(line) == "", line == ".", strings.HasPrefix(line, `.\"`), strings.HasPrefix(line, `'\"`):
+			continue
+		case isMacro(line, "so") && !alias:
+			alias = true
+		default:
+			return false
+		}
+	}
+	return alias
+}
+
+func readMaybeCompressed(path, ext string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	switch ext {
+	case ".gz":
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	case ".bz2":
+		r = bzip2.NewReader(f)
+	}
+	return io.ReadAll(r)
+}
+
+// manBuilder tracks fill mode and the current section on top of docBuilder.
+type manBuilder struct {
+	*docBuilder
+	section string
+	noFill  bool
+	literal []string
+	// name and description from the NAME section, for the title
+	nameLine string
+	// mdoc .Nm remembers the first name it is given
+	mdocName string
+}
+
+// ParseManPage converts troff source into a page. name and section come from
+// the file name and are replaced by .TH/.Dt when present.
+func ParseManPage(name, section string, data []byte) models.ScrapedPage {
+	b := &manBuilder{docBuilder: newDocBuilder("")}
+
+	for _, raw := range splitLines(data) {
+		line := raw
+		if strings.HasPrefix(line, `.\"`) || strings.HasPrefix(line, `'\"`) || line == "." {
+			continue
+		}
+
+		if b.noFill && !isMacro(line, "fi", "EE", "Ed") {
+			b.literal = append(b.literal, manText(line))
+			continue
+		}
+
+		if !strings.HasPrefix(line, ".") && !strings.HasPrefix(line, "'") {
+			b.addText(manText(line))
+			continue
+		}
+
+		macro, args := splitMacro(line)
+		switch macro {
+		case "TH", "Dt":
+			if len(args) > 0 {
+				name = strings.ToLower(args[0])
+			}
+			if len(args) > 1 {
+				section = strings.ToLower(args[1])
+			}
+		case "SH", "Sh":
+			b.flushLiteral()
+			b.section = strings.ToUpper(strings.Join(args, " "))
+			b.heading(2, b.section)
+		case "SS", "Ss":
+			b.flushLiteral()
+			b.heading(3, strings.Join(args, " "))
+		case "PP", "P", "LP", "Pp", "sp", "br", "RS", "RE", "in":
+			b.flush()
+		case "TP", "IP", "It":
+			// tagged paragraphs, each option gets its own section
+			b.flush()
+			if macro == "It" && len(args) > 0 {
+				b.addText(mdocInline(args))
+			} else if macro == "IP" && len(args) > 0 && args[0] != `\(bu` && args[0] != "-" {
+				b.addText(manText(args[0]))
+			}
+		case "nf", "EX", "Bd":
+			if macro == "Bd" && !hasArg(args, "-literal", "-unfilled") {
+				b.flush()
+				continue
+			}
+			b.flush()
+			b.noFill = true
+		case "fi", "EE", "Ed":
+			b.flushLiteral()
+		case "B", "I", "SM", "SB":
+			b.addText(manText(strings.Join(args, " ")))
+		case "BR", "BI", "IB", "IR", "RB", "RI":
+			// alternating fonts, the arguments run together
+			b.addText(manText(strings.Join(args, "")))
+		case "UR", "MT":
+			// the link text follows, the url itself is noise
+		case "Nm":
+			if b.mdocName == "" && len(args) > 0 {
+				b.mdocName = args[0]
+			}
+			if len(args) == 0 {
+				args = []string{b.mdocName}
+			}
+			b.addText(mdocInline(args))
+		case "Nd":
+			desc := strings.Join(args, " ")
+			if b.section == "NAME" && b.nameLine == "" {
+				b.nameLine = desc
+			}
+			b.text("- " + desc)
+		case "so", "Dd", "Os", "Bl", "El", "ad", "na", "hy", "nh", "ne", "ft", "ps", "ds", "de", "ie", "if", "el", "ta", "ti", "ll", "nr", "TS", "TE":
+			// formatting requests with no content
+		default:
+			if strings.HasPrefix(macro, "\\") {
+				continue
+			}
+			// remaining mdoc macros are inline markup
+			if len(macro) == 2 && macro[0] >= 'A' && macro[0] <= 'Z' && macro[1] >= 'a' && macro[1] <= 'z' {
+				b.addText(mdocInline(append([]string{macro}, args...)))
+			}
+		}
+	}
+	b.flushLiteral()
+
+	page := b.done()
+	page.URL = fmt.Sprintf("man:%s(%s)", name, section)
+	page.Source = models.SourceMan
+	page.Title = fmt.Sprintf("%s(%s)", name, section)
+	if b.nameLine != "" {
+		page.Title += " - " + b.nameLine
+	}
+	return page
+}
+
+func (b *manBuilder) addText(text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	if b.section == "NAME" && b.nameLine == "" {
+		// "ls \- list directory contents" -> "list directory contents"
+		if _, desc, ok := strings.Cut(text, " - "); ok {
+			b.nameLine = strings.TrimSpace(desc)
+		}
+	}
+	b.text(text)
+}
+
+// flushLiteral ends a no-fill block. Blocks in EXAMPLES and SYNOPSIS are
+// shell, the rest is kept as code without a language.
+func (b *manBuilder) flushLiteral() {
+	b.noFill = false
+	if len(b.literal) == 0 {
+		return
+	}
+	lang := ""
+	if b.section == "EXAMPLES" || b.section == "EXAMPLE" || b.section == "SYNOPSIS" {
+		lang = "sh"
+	}
+	b.code(lang, b.literal)
+	b.literal = nil
+}
+
+func isMacro(line string, names ...string) bool {
+	if !strings.HasPrefix(line, ".") {
+		return false
+	}
+	macro, _ := splitMacro(line)
+	for _, n := range names {
+		if macro == n {
+			return true
+		}
+	}
+	return false
+}
+
+func hasArg(args []string, want ...string) bool {
+	for _, a := range args {
+		for _, w := range want {
+			if a == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitMacro splits a request line into its name and arguments, honouring
+// double quoted arguments.
+func splitMacro(line string) (string, []string) {
+	line = strings.TrimSpace(line[1:])
+	var args []string
+	var cur strings.Builder
+	inQuote, started := false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '"' && inQuote && i+1 < len(line) && line[i+1] == '"':
+			cur.WriteByte('"')
+			i++
+		case c == '"':
+			inQuote = !inQuote
+			started = true
+		case (c == ' ' || c == '\t') && !inQuote:
+			if started || cur.Len() > 0 {
+				args = append(args, cur.String())
+				cur.Reset()
+				started = false
+			}
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	if started || cur.Len() > 0 {
+		args = append(args, cur.String())
+	}
+	if len(args) == 0 {
+		return "", nil
+	}
+	return args[0], args[1:]
+}
+
+var (
+	fontEscape = regexp.MustCompile(`\\f(\[[^\]]*\]|\([A-Za-z0-9]{2}|[A-Za-z0-9])`)
+	sizeEscape = regexp.MustCompile(`\\s[+-]?\d`)
+	charEscape = regexp.MustCompile(`\\(\([A-Za-z0-9]{2}|\[[^\]]*\])`)
+	strEscape  = regexp.MustCompile(`\\\*(\([A-Za-z]{2}|\[[^\]]*\]|[A-Za-z])`)
+)
+
+var troffChars = map[string]string{
+	"em": "-", "en": "-", "hy": "-", "mi": "-", "aq": "'", "dq": `"`,
+	"lq": `"`, "rq": `"`, "oq": "'", "cq": "'", "bu": "*", "co": "(c)",
+	"rg": "(R)", "tm": "(tm)", "ga": "`", "ti": "~", "ha": "^", "rs": `\`,
+	"bv": "|", "ba": "|", "lh": "<=", "rh": "=>", "->": "->", "<-": "<-",
+	"R": "(R)", "Tm": "(tm)",
+}
+
+// manText strips troff escapes from a line of text.
+func manText(s string) string {
+	s = fontEscape.ReplaceAllString(s, "")
+	s = sizeEscape.ReplaceAllString(s, "")
+	s = charEscape.ReplaceAllStringFunc(s, func(m string) string {
+		return troffChars[strings.Trim(m[1:], "([]")]
+	})
+	s = strEscape.ReplaceAllStringFunc(s, func(m string) string {
+		return troffChars[strings.Trim(m[2:], "([]")]
+	})
+	r := strings.NewReplacer(
+		`\-`, "-", `\e`, `\`, `\\`, `\`, `\&`, "", `\~`, " ", `\ `, " ", `\0`, " ",
+		`\|`, "", `\^`, "", `\%`, "", `\c`, "", `\:`, "", `\/`, "", `\,`, "", `\)`, "",
+	)
+	return r.Replace(s)
+}
+
+// mdoc inline macros and what they render as
+var mdocMacros = map[string]string{
+	"Fl": "-", "Ar": "", "Cm": "", "Ic": "", "Pa": "", "Ev": "", "Em": "", "Sy": "",
+	"Li": "", "Va": "", "Fn": "", "Fa": "", "Ft": "", "Dv": "", "Er": "", "Ad": "",
+	"Ms": "", "No": "", "Ns": "", "Ql": "", "Tn": "", "Cd": "", "Vt": "", "Lb": "",
+}
+
+// mdocInline renders an mdoc line such as "Op Fl a Ar file" as "[-a file]".
+func mdocInline(words []string) string {
+	var out []string
+	// Op and Dq enclose the rest of the line
+	var closers []string
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		switch w {
+		case "Op":
+			out = append(out, "[")
+			closers = append(closers, "]")
+			continue
+		case "Oo":
+			out = append(out, "[")
+			continue
+		case "Oc":
+			out = append(out, "]")
+			continue
+		case "Dq":
+			out = append(out, `"`)
+			closers = append(closers, `"`)
+			continue
+		case "Do", "Dc":
+			out = append(out, `"`)
+			continue
+		case "Xr":
+			if i+2 < len(words) {
+				out = append(out, words[i+1]+"("+words[i+2]+")")
+				i += 2
+			}
+			continue
+		case "Sm":
+			// spacing mode toggle
+			i++
+			continue
+		case "Ux":
+			out = append(out, "UNIX")
+			continue
+		case "Nm":
+			continue
+		}
+		if prefix, ok := mdocMacros[w]; ok {
+			if prefix != "" && i+1 < len(words) {
+				out = append(out, prefix+words[i+1])
+				i++
+			}
+			continue
+		}
+		out = append(out, manText(w))
+	}
+	for i := len(closers) - 1; i >= 0; i-- {
+		out = append(out, closers[i])
+	}
+
+	text := strings.Join(out, " ")
+	text = strings.NewReplacer("[ ", "[", " ]", "]", `" `, `"`).Replace(text)
+	return strings.TrimSpace(text)
+}
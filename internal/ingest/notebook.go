@@ -0,0 +1,165 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"oss/internal/models"
+)
+
+// NotebookSource reads Jupyter notebooks (.ipynb, nbformat 4) from disk.
+// Markdown cells become text sections, code cells become code sections tagged
+// with the kernel language.
+type NotebookSource struct {
+	Root    string
+	BaseURL string
+	// IncludeOutputs adds the plain text output of code cells as text sections
+	IncludeOutputs bool
+}
+
+// nbText is a notebook string field, stored either as one string or as a
+// list of lines.
+type nbText string
+
+func (t *nbText) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*t = nbText(strings.Join(lines, ""))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*t = nbText(s)
+	return nil
+}
+
+type notebook struct {
+	NBFormat int `json:"nbformat"`
+	Metadata struct {
+		Kernelspec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+	Cells []struct {
+		CellType string   `json:"cell_type"`
+		Source   nbText   `json:"source"`
+		Outputs  []output `json:"outputs"`
+	} `json:"cells"`
+}
+
+type output struct {
+	OutputType string `json:"output_type"`
+	Text       nbText `json:"text"`
+	// mime bundle, only text/plain is read, other types may hold json
+	// objects such as widget views
+	Data map[string]json.RawMessage `json:"data"`
+}
+
+func (n *notebook) language() string {
+	if n.Metadata.LanguageInfo.Name != "" {
+		return n.Metadata.LanguageInfo.Name
+	}
+	if n.Metadata.Kernelspec.Language != "" {
+		return n.Metadata.Kernelspec.Language
+	}
+	return "python"
+}
+
+func (s *NotebookSource) Walk(ctx context.Context, fn func(models.ScrapedPage) error) error {
+	return walkFiles(ctx, s.Root, []string{".ipynb"}, func(path, rel string) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		u, err := pageURL(s.BaseURL, s.Root, rel)
+		if err != nil {
+			return err
+		}
+
+		page, err := ParseNotebook(u, data, s.IncludeOutputs)
+		if err != nil {
+			// one broken notebook shouldn't stop the import
+			log.Printf("skipping notebook %s: %v\n", rel, err)
+			return nil
+		}
+		if page.Title == "" {
+			page.Title = strings.TrimSuffix(filepath.Base(rel), ".ipynb")
+		}
+		page.Source = models.SourceNotebook
+		return fn(page)
+	})
+}
+
+// ParseNotebook converts notebook json into a page.
+func ParseNotebook(pageURL string, data []byte, includeOutputs bool) (models.ScrapedPage, error) {
+	var nb notebook
+	if err := json.Unmarshal(data, &nb); err != nil {
+		return models.ScrapedPage{}, err
+	}
+	if nb.NBFormat < 4 {
+		return models.ScrapedPage{}, fmt.Errorf("unsupported nbformat %d", nb.NBFormat)
+	}
+
+	lang := strings.ToLower(nb.language())
+	b := newDocBuilder(pageURL)
+
+	for _, cell := range nb.Cells {
+		src := string(cell.Source)
+		switch cell.CellType {
+		case "markdown":
+			b.markdown(splitLines([]byte(src)))
+		case "code":
+			b.code(lang, strings.Split(src, "\n"))
+			if includeOutputs {
+				for _, out := range cell.Outputs {
+					b.output(out)
+				}
+			}
+		case "raw":
+			// raw cells are passed through by nbconvert untouched
+			for _, l := range splitLines([]byte(src)) {
+				if strings.TrimSpace(l) == "" {
+					b.flush()
+					continue
+				}
+				b.text(l)
+			}
+			b.flush()
+		}
+	}
+	return b.done(), nil
+}
+
+// output adds the plain text form of a cell output. Images, html and
+// tracebacks are skipped.
+func (b *docBuilder) output(out output) {
+	var text string
+	switch out.OutputType {
+	case "stream":
+		text = string(out.Text)
+	case "execute_result", "display_data":
+		var plain nbText
+		if raw, ok := out.Data["text/plain"]; ok && json.Unmarshal(raw, &plain) == nil {
+			text = string(plain)
+		}
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	b.flush()
+	b.page.Sections = append(b.page.Sections, models.PageSection{
+		Type:    "text",
+		Content: text,
+	})
+}
@@ -0,0 +1,333 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"oss/internal/models"
+
+	"github.com/goccy/go-yaml"
+)
+
+// OpenAPISource reads OpenAPI 3 documents (json or yaml) and emits one page
+// per operation. Json and yaml files that aren't OpenAPI documents are
+// ignored, so it can be pointed at a whole repository.
+type OpenAPISource struct {
+	Root    string
+	BaseURL string
+}
+
+var httpMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// schemas are inlined up to this many levels of $ref
+const maxSchemaDepth = 2
+
+func (s *OpenAPISource) Walk(ctx context.Context, fn func(models.ScrapedPage) error) error {
+	return walkFiles(ctx, s.Root, []string{".json", ".yaml", ".yml"}, func(path, rel string) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		u, err := pageURL(s.BaseURL, s.Root, rel)
+		if err != nil {
+			return err
+		}
+
+		pages, err := ParseOpenAPI(u, data)
+		if err != nil {
+			log.Printf("skipping %s: %v\n", rel, err)
+			return nil
+		}
+		for _, p := range pages {
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type apiSpec struct {
+	root map[string]any
+}
+
+// ParseOpenAPI returns one page per operation in the document at specURL.
+// Documents that aren't OpenAPI 3 yield no pages.
+func ParseOpenAPI(specURL string, data []byte) ([]models.ScrapedPage, error) {
+	// yaml is a superset of json, so one path handles both
+	js, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var root map[string]any
+	if err := json.Unmarshal(js, &root); err != nil {
+		return nil, nil
+	}
+	version, _ := root["openapi"].(string)
+	if !strings.HasPrefix(version, "3.") {
+		return nil, nil
+	}
+
+	spec := &apiSpec{root: root}
+	info := obj(root["info"])
+	apiTitle := str(info["title"])
+
+	paths := obj(root["paths"])
+	var pages []models.ScrapedPage
+	for _, p := range sortedKeys(paths) {
+		item := spec.resolve(paths[p])
+		for _, method := range httpMethods {
+			op, ok := item[method].(map[string]any)
+			if !ok {
+				continue
+			}
+			pages = append(pages, spec.operationPage(specURL, apiTitle, method, p, item, op))
+		}
+	}
+	return pages, nil
+}
+
+func (s *apiSpec) operationPage(specURL, apiTitle, method, path string, item, op map[string]any) models.ScrapedPage {
+	b := newDocBuilder("")
+	endpoint := strings.ToUpper(method) + " " + path
+
+	anchor := str(op["operationId"])
+	if anchor == "" {
+		anchor = method + path
+	}
+	b.page.URL = specURL + "#operation/" + anchor
+	b.page.Source = models.SourceOpenAPI
+	b.page.Tags = strList(op["tags"])
+
+	b.page.Title = endpoint
+	if summary := str(op["summary"]); summary != "" {
+		b.page.Title = summary + " (" + endpoint + ")"
+	}
+
+	line := endpoint
+	if apiTitle != "" {
+		line += " - " + apiTitle
+	}
+	if tags := strList(op["tags"]); len(tags) > 0 {
+		line += " [" + strings.Join(tags, ", ") + "]"
+	}
+	b.text(line)
+	b.flush()
+	if op["deprecated"] == true {
+		b.text("Deprecated.")
+		b.flush()
+	}
+	b.markdown(splitLines([]byte(str(op["description"]))))
+
+	// path level parameters apply to every operation unless overridden
+	params := map[string]map[string]any{}
+	var order []string
+	for _, list := range []any{item["parameters"], op["parameters"]} {
+		for _, raw := range arr(list) {
+			p := s.resolve(raw)
+			key := str(p["in"]) + ":" + str(p["name"])
+			if _, seen := params[key]; !seen {
+				order = append(order, key)
+			}
+			params[key] = p
+		}
+	}
+	if len(order) > 0 {
+		b.heading(2, "Parameters")
+		for _, key := range order {
+			b.text(s.describeParam(params[key]))
+			b.flush()
+		}
+	}
+
+	if body := s.resolve(op["requestBody"]); len(body) > 0 {
+		b.heading(2, "Request body")
+		b.markdown(splitLines([]byte(str(body["description"]))))
+		s.content(b, obj(body["content"]))
+	}
+
+	responses := obj(op["responses"])
+	if len(responses) > 0 {
+		b.heading(2, "Responses")
+		for _, code := range sortedKeys(responses) {
+			res := s.resolve(responses[code])
+			b.text(code + ": " + str(res["description"]))
+			b.flush()
+			s.content(b, obj(res["content"]))
+		}
+	}
+	return b.done()
+}
+
+func (s *apiSpec) describeParam(p map[string]any) string {
+	var attrs []string
+	if in := str(p["in"]); in != "" {
+		attrs = append(attrs, in)
+	}
+	if t := schemaType(s.resolve(p["schema"])); t != "" {
+		attrs = append(attrs, t)
+	}
+	if p["required"] == true {
+		attrs = append(attrs, "required")
+	}
+	text := str(p["name"])
+	if len(attrs) > 0 {
+		text += " (" + strings.Join(attrs, ", ") + ")"
+	}
+	if d := str(p["description"]); d != "" {
+		text += ": " + d
+	}
+	return text
+}
+
+// content adds the schema and examples of each media type as code.
+func (s *apiSpec) content(b *docBuilder, content map[string]any) {
+	for _, mediaType := range sortedKeys(content) {
+		media := s.resolve(content[mediaType])
+		lang := "json"
+		if !strings.Contains(mediaType, "json") {
+			lang = ""
+		}
+
+		if schema, ok := media["schema"]; ok {
+			b.text("Schema (" + mediaType + ")")
+			b.flush()
+			b.code("json", strings.Split(marshalIndent(s.inline(schema, 0)), "\n"))
+		}
+
+		var examples []any
+		if ex, ok := media["example"]; ok {
+			examples = append(examples, ex)
+		}
+		named := obj(media["examples"])
+		for _, name := range sortedKeys(named) {
+			if v, ok := s.resolve(named[name])["value"]; ok {
+				examples = append(examples, v)
+			}
+		}
+		if len(examples) == 0 {
+			if ex, ok := s.resolve(media["schema"])["example"]; ok {
+				examples = append(examples, ex)
+			}
+		}
+		for _, ex := range examples {
+			if text, ok := ex.(string); ok {
+				b.code(lang, strings.Split(text, "\n"))
+				continue
+			}
+			b.code(lang, strings.Split(marshalIndent(ex), "\n"))
+		}
+	}
+}
+
+// resolve follows local $refs ("#/components/...") until it reaches an
+// object. External refs are left unresolved.
+func (s *apiSpec) resolve(node any) map[string]any {
+	m := obj(node)
+	for i := 0; i < 16; i++ {
+		ref, ok := m["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#/") {
+			return m
+		}
+		m = obj(s.pointer(ref))
+	}
+	return m
+}
+
+func (s *apiSpec) pointer(ref string) any {
+	var cur any = s.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		cur = obj(cur)[part]
+	}
+	return cur
+}
+
+// inline copies a schema with refs replaced by their targets, stopping at
+// maxSchemaDepth so recursive schemas terminate.
+func (s *apiSpec) inline(node any, depth int) any {
+	switch v := node.(type) {
+	case map[string]any:
+		if ref, ok := v["$ref"].(string); ok {
+			if depth >= maxSchemaDepth || !strings.HasPrefix(ref, "#/") {
+				return map[string]any{"$ref": ref}
+			}
+			return s.inline(s.pointer(ref), depth+1)
+		}
+		out := make(map[string]any, len(v))
+		for k, child := range v {
+			out[k] = s.inline(child, depth)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, child := range v {
+			out[i] = s.inline(child, depth)
+		}
+		return out
+	}
+	return node
+}
+
+func schemaType(schema map[string]any) string {
+	t := str(schema["type"])
+	if t == "array" {
+		if items := str(obj(schema["items"])["type"]); items != "" {
+			return "array of " + items
+		}
+	}
+	if f := str(schema["format"]); f != "" && t != "" {
+		return t + ", " + f
+	}
+	return t
+}
+
+func obj(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	return m
+}
+
+func arr(v any) []any {
+	a, _ := v.([]any)
+	return a
+}
+
+func str(v any) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func strList(v any) []string {
+	var out []string
+	for _, item := range arr(v) {
+		out = append(out, str(item))
+	}
+	return out
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func marshalIndent(v any) string {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
@@ -0,0 +1,259 @@
+package ingest
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"oss/internal/models"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// StackExchangeSource reads a Stack Exchange data dump Posts.xml and emits
+// one page per question, with its accepted answer. Answers follow their
+// question in the dump, so a first pass notes where each accepted answer is
+// and the second reads it back when its question comes up. Only ids and
+// offsets are held in memory, however large the dump.
+type StackExchangeSource struct {
+	Path string
+	// SiteURL is the site the dump came from, e.g. https://stackoverflow.com
+	SiteURL string
+	// MinScore drops questions voted below it
+	MinScore int
+	// IncludeUnanswered keeps questions without an accepted answer
+	IncludeUnanswered bool
+}
+
+// post is a <row> of Posts.xml
+type post struct {
+	ID               int    `xml:"Id,attr"`
+	PostTypeID       int    `xml:"PostTypeId,attr"`
+	AcceptedAnswerID int    `xml:"AcceptedAnswerId,attr"`
+	ParentID         int    `xml:"ParentId,attr"`
+	Score            int    `xml:"Score,attr"`
+	Title            string `xml:"Title,attr"`
+	Body             string `xml:"Body,attr"`
+	Tags             string `xml:"Tags,attr"`
+}
+
+const (
+	postQuestion = 1
+	postAnswer   = 2
+)
+
+func (s *StackExchangeSource) Walk(ctx context.Context, fn func(models.ScrapedPage) error) error {
+	answers, err := s.acceptedAnswers(ctx)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	answerFile, err := os.Open(s.Path)
+	if err != nil {
+		return err
+	}
+	defer answerFile.Close()
+
+	return s.eachPost(ctx, f, func(q post, _ int64) error {
+		if q.PostTypeID != postQuestion || q.Score < s.MinScore {
+			return nil
+		}
+		offset, ok := answers[q.AcceptedAnswerID]
+		// unanswered, or the accepted answer is missing from the dump
+		if !ok || offset < 0 {
+			if s.IncludeUnanswered {
+				return fn(s.page(q, nil))
+			}
+			return nil
+		}
+		answer, err := readPostAt(answerFile, offset)
+		if err != nil {
+			return fmt.Errorf("reading answer %d of question %d: %v", q.AcceptedAnswerID, q.ID, err)
+		}
+		return fn(s.page(q, &answer))
+	})
+}
+
+// acceptedAnswers returns the offset of the accepted answer of every
+// question scoring at least MinScore, by answer id, -1 for answers missing
+// from the dump.
+func (s *StackExchangeSource) acceptedAnswers(ctx context.Context) (map[int]int64, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	answers := map[int]int64{}
+	err = s.eachPost(ctx, f, func(p post, offset int64) error {
+		switch p.PostTypeID {
+		case postQuestion:
+			if p.AcceptedAnswerID != 0 && p.Score >= s.MinScore {
+				answers[p.AcceptedAnswerID] = -1
+			}
+		case postAnswer:
+			if _, ok := answers[p.ID]; ok {
+				answers[p.ID] = offset
+			}
+		}
+		return nil
+	})
+	return answers, err
+}
+
+// eachPost calls fn with every row of the dump and its offset in r.
+func (s *StackExchangeSource) eachPost(ctx context.Context, r io.Reader, fn func(p post, offset int64) error) error {
+	dec := xml.NewDecoder(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %v", s.Path, err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		var p post
+		if err := dec.DecodeElement(&p, &start); err != nil {
+			return err
+		}
+		if err := fn(p, offset); err != nil {
+			return err
+		}
+	}
+}
+
+// readPostAt decodes the row starting at offset.
+func readPostAt(f *os.File, offset int64) (post, error) {
+	dec := xml.NewDecoder(io.NewSectionReader(f, offset, math.MaxInt64-offset))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return post{}, err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			var p post
+			err := dec.DecodeElement(&p, &start)
+			return p, err
+		}
+	}
+}
+
+func (s *StackExchangeSource) page(q post, answer *post) models.ScrapedPage {
+	page := models.ScrapedPage{
+		URL:       strings.TrimSuffix(s.SiteURL, "/") + "/questions/" + strconv.Itoa(q.ID),
+		Title:     q.Title,
+		CrawledAt: time.Now().Format(time.RFC3339),
+		Source:    models.SourceStackExchange,
+		Tags:      parseTags(q.Tags),
+		Votes:     q.Score,
+	}
+
+	page.Sections = append(page.Sections, models.PageSection{Type: "text", Content: "## Question"})
+	page.Sections = append(page.Sections, postSections(q.Body)...)
+	if answer != nil {
+		page.Sections = append(page.Sections, models.PageSection{
+			Type:    "text",
+			Content: fmt.Sprintf("## Accepted answer (score %d)", answer.Score),
+		})
+		page.Sections = append(page.Sections, postSections(answer.Body)...)
+	}
+	return page
+}
+
+// parseTags handles both the old "<python><numpy>" and the newer
+// "|python|numpy|" tag formats.
+func parseTags(tags string) []string {
+	var out []string
+	for _, t := range strings.FieldsFunc(tags, func(r rune) bool {
+		return r == '<' || r == '>' || r == '|'
+	}) {
+		out = append(out, t)
+	}
+	return out
+}
+
+// postSections extracts text and code from post html. Code blocks carry a
+// lang-* class when the author or the site picked a highlighter.
+func postSections(body string) []models.PageSection {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+	if err != nil {
+		return nil
+	}
+
+	var sections []models.PageSection
+	doc.Find("p, pre, li, blockquote, h1, h2, h3, h4").Each(func(_ int, el *goquery.Selection) {
+		// list items and quotes are emitted whole unless they hold
+		// paragraphs or code, which are then emitted on their own
+		if el.ParentsFiltered("pre").Length() > 0 || isWholeBlock(el.ParentsFiltered("li, blockquote")) {
+			return
+		}
+		if name := goquery.NodeName(el); (name == "li" || name == "blockquote") && !isWholeBlock(el) {
+			return
+		}
+
+		text := strings.TrimSpace(el.Text())
+		if text == "" {
+			return
+		}
+
+		switch goquery.NodeName(el) {
+		case "pre":
+			sections = append(sections, models.PageSection{
+				Type:     "code",
+				Content:  text,
+				Language: postLanguage(el),
+			})
+		case "h1", "h2", "h3", "h4":
+			sections = append(sections, models.PageSection{
+				Type:    "text",
+				Content: "## " + text,
+			})
+		default:
+			sections = append(sections, models.PageSection{
+				Type:    "text",
+				Content: text,
+			})
+		}
+	})
+	return sections
+}
+
+func isWholeBlock(sel *goquery.Selection) bool {
+	whole := false
+	sel.EachWithBreak(func(_ int, el *goquery.Selection) bool {
+		whole = el.Find("p, pre").Length() == 0
+		return !whole
+	})
+	return whole
+}
+
+func postLanguage(pre *goquery.Selection) string {
+	classes := pre.AttrOr("class", "") + " " + pre.Find("code").AttrOr("class", "")
+	for _, c := range strings.Fields(classes) {
+		if lang, ok := strings.CutPrefix(c, "lang-"); ok {
+			return lang
+		}
+		if lang, ok := strings.CutPrefix(c, "language-"); ok {
+			return lang
+		}
+	}
+	return ""
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// FrontierURL is a url in the shared crawl frontier, leased to one worker at
+// a time.
+type FrontierURL struct {
+	ID       int64  `json:"id"`
+	URL      string `json:"url"`
+	Domain   string `json:"domain"`
+	Depth    int    `json:"depth"`
+	Attempts int    `json:"attempts"`
+}
+
+// Worker is a crawl worker as last reported by its heartbeat.
+type Worker struct {
+	ID          string     `json:"id"`
+	Host        string     `json:"host"`
+	StartedAt   time.Time  `json:"started_at"`
+	HeartbeatAt time.Time  `json:"heartbeat_at"`
+	StoppedAt   *time.Time `json:"stopped_at,omitempty"`
+	CurrentURL  string     `json:"current_url,omitempty"`
+	Fetched     int        `json:"fetched"`
+	// Alive is false once the worker stops or misses its heartbeats
+	Alive bool `json:"alive"`
+}
@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+// CrawlRun is the report of one crawl, stored so runs can be compared.
+type CrawlRun struct {
+	ID         int64     `json:"id"`
+	Source     string    `json:"source"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Fetched    int       `json:"fetched"`
+	Saved      int       `json:"saved"`
+	Skipped    int       `json:"skipped"`
+	Failed     int       `json:"failed"`
+	Bytes      int64     `json:"bytes"`
+	// responses by http status code
+	Statuses map[int]int `json:"statuses"`
+	// errors by type, e.g. timeout, dns, http, save
+	Errors   map[string]int `json:"errors"`
+	SlowURLs []URLTiming    `json:"slow_urls"`
+}
+
+type URLTiming struct {
+	URL      string `json:"url"`
+	Duration int64  `json:"duration_ms"`
+}
+
+// RunDiff is how a crawl run changed relative to an earlier one. Each delta
+// is head minus base.
+type RunDiff struct {
+	Base     *CrawlRun      `json:"base"`
+	Head     *CrawlRun      `json:"head"`
+	Duration int64          `json:"duration_ms"`
+	Fetched  int            `json:"fetched"`
+	Saved    int            `json:"saved"`
+	Skipped  int            `json:"skipped"`
+	Failed   int            `json:"failed"`
+	Bytes    int64          `json:"bytes"`
+	Statuses map[int]int    `json:"statuses"`
+	Errors   map[string]int `json:"errors"`
+}
+
+func (r *CrawlRun) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// CompareRuns lists the changes from base to head. Statuses and error types
+// that didn't change are left out.
+func CompareRuns(base, head *CrawlRun) RunDiff {
+	return RunDiff{
+		Base:     base,
+		Head:     head,
+		Duration: (head.Duration() - base.Duration()).Milliseconds(),
+		Fetched:  head.Fetched - base.Fetched,
+		Saved:    head.Saved - base.Saved,
+		Skipped:  head.Skipped - base.Skipped,
+		Failed:   head.Failed - base.Failed,
+		Bytes:    head.Bytes - base.Bytes,
+		Statuses: diffCounts(base.Statuses, head.Statuses),
+		Errors:   diffCounts(base.Errors, head.Errors),
+	}
+}
+
+func diffCounts[K comparable](base, head map[K]int) map[K]int {
+	diff := map[K]int{}
+	for k, n := range head {
+		if d := n - base[k]; d != 0 {
+			diff[k] = d
+		}
+	}
+	for k, n := range base {
+		if _, ok := head[k]; !ok {
+			diff[k] = -n
+		}
+	}
+	return diff
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Source is a site registered for crawling. Pages crawled from it carry its
+// id.
+type Source struct {
+	ID       int64          `json:"id"`
+	Name     string         `json:"name"`
+	Domains  []string       `json:"domains"` // hosts links may be followed to
+	Seeds    []string       `json:"seeds"`   // start urls
+	Settings SourceSettings `json:"settings"`
+	Owner    string         `json:"owner,omitempty"`
+	// disabled sources keep their pages but aren't crawled
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SourceSettings tune how a source is crawled, zero values use the
+// crawler's defaults.
+type SourceSettings struct {
+	DelayMS     int `json:"delay_ms,omitempty"`    // between fetches from one domain
+	Parallelism int `json:"parallelism,omitempty"` // fetches at once
+	MaxDepth    int `json:"max_depth,omitempty"`   // links followed from a seed
+	// sphinx objects.inv urls symbols are loaded from
+	Inventories []string `json:"inventories,omitempty"`
+}
+
+// Validate checks a source is crawlable: it has a name, domains, and seeds
+// that are http urls on those domains. Domains are lowercased.
+func (s *Source) Validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(s.Domains) == 0 {
+		return fmt.Errorf("at least one domain is required")
+	}
+	if len(s.Seeds) == 0 {
+		return fmt.Errorf("at least one seed url is required")
+	}
+	for i, d := range s.Domains {
+		s.Domains[i] = strings.ToLower(strings.TrimSpace(d))
+		if s.Domains[i] == "" || strings.ContainsAny(s.Domains[i], "/:") {
+			return fmt.Errorf("domain %q should be a bare host name", d)
+		}
+	}
+	for _, seed := range s.Seeds {
+		u, err := url.Parse(seed)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("seed %q is not an http or https url", seed)
+		}
+		if !slices.Contains(s.Domains, strings.ToLower(u.Hostname())) {
+			return fmt.Errorf("seed %q is not on one of the source's domains", seed)
+		}
+	}
+	if s.Settings.DelayMS < 0 || s.Settings.Parallelism < 0 || s.Settings.MaxDepth < 0 {
+		return fmt.Errorf("settings can't be negative")
+	}
+	return nil
+}
@@ -1,9 +1,66 @@
 package models
 
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
 type PageSection struct {
-	Type     string `json:"type"` // code or text
+	Type     string `json:"type"` // code, text, table or list
 	Content  string `json:"content"`
 	Language string `json:"language,omitempty"` // e.g. go, python, c
+	// structured form of table and list sections, Content holds them
+	// rendered as plain text for search
+	Table *Table `json:"table,omitempty"`
+	List  *List  `json:"list,omitempty"`
+}
+
+type Table struct {
+	Header []string   `json:"header,omitempty"`
+	Rows   [][]string `json:"rows"`
+}
+
+type List struct {
+	Ordered bool     `json:"ordered"`
+	Items   []string `json:"items"`
+}
+
+// Render formats the table as pipe separated lines.
+func (t *Table) Render() string {
+	var lines []string
+	if len(t.Header) > 0 {
+		lines = append(lines, strings.Join(t.Header, " | "))
+	}
+	for _, row := range t.Rows {
+		lines = append(lines, strings.Join(row, " | "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Render formats the list as markdown style items.
+func (l *List) Render() string {
+	var lines []string
+	for i, item := range l.Items {
+		if l.Ordered {
+			lines = append(lines, fmt.Sprintf("%d. %s", i+1, item))
+		} else {
+			lines = append(lines, "- "+item)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Truncate cuts s to at most n bytes, marked with "...", without splitting a
+// utf-8 sequence.
+func Truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
 }
 
 type ScrapedPage struct {
@@ -11,4 +68,41 @@ type ScrapedPage struct {
 	Title     string        `json:"title"`
 	Sections  []PageSection `json:"sections"`
 	CrawledAt string        `json:"crawled_at"`
+	Source    string        `json:"source,omitempty"` // where the page came from, e.g. web, man, stackexchange
+	Tags      []string      `json:"tags,omitempty"`
+	Votes     int           `json:"votes,omitempty"` // community score for q&a pages
+
+	Description string            `json:"description,omitempty"`
+	OpenGraph   map[string]string `json:"opengraph,omitempty"` // og:* properties without the prefix
+	Breadcrumbs []string          `json:"breadcrumbs,omitempty"`
+	LastUpdated string            `json:"last_updated,omitempty"` // 2006-01-02, when the page shows it
+	Deprecated  string            `json:"deprecated,omitempty"`   // the notice marking the page deprecated
+	Quality     float64           `json:"quality,omitempty"`      // 0 to 1, see package quality
+	Private     bool              `json:"private,omitempty"`      // fetched with credentials
+	SourceID    int64             `json:"source_id,omitempty"`    // the registered source it was crawled from
+}
+
+// page sources, used to filter searches
+const (
+	SourceWeb           = "web"
+	SourceDocs          = "docs"
+	SourceNotebook      = "notebook"
+	SourceGoDoc         = "godoc"
+	SourceOpenAPI       = "openapi"
+	SourceMan           = "man"
+	SourceDocset        = "docset"
+	SourceStackExchange = "stackexchange"
+)
+
+// Symbol is a documented object (function, class, option, ...) and the exact
+// url of its anchor, e.g. from a sphinx objects.inv inventory.
+type Symbol struct {
+	Name        string `json:"name"`
+	Domain      string `json:"domain"` // e.g. py, c, std
+	Role        string `json:"role"`   // e.g. function, class, label
+	URL         string `json:"url"`
+	DisplayName string `json:"display_name,omitempty"`
+	Project     string `json:"project,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Priority    int    `json:"priority"`
 }
@@ -0,0 +1,81 @@
+package models
+
+import "time"
+
+// PageVersion is a snapshot of a page taken when a save changed it.
+type PageVersion struct {
+	Version   int          `json:"version"`
+	CreatedAt time.Time    `json:"created_at"`
+	Title     string       `json:"title"`
+	Hash      string       `json:"hash"`
+	Page      *ScrapedPage `json:"page,omitempty"`
+}
+
+// SectionChange is one step of a section level diff. Changed pairs a
+// removed and an added section of the same type at the same place.
+type SectionChange struct {
+	Op   string       `json:"op"` // added, removed or changed
+	From *PageSection `json:"from,omitempty"`
+	To   *PageSection `json:"to,omitempty"`
+	// position of the section in the newer version, or where it was removed
+	Index int `json:"index"`
+}
+
+// DiffSections lists the section changes between two versions of a page,
+// based on the longest common run of identical sections.
+func DiffSections(from, to []PageSection) []SectionChange {
+	// lcs[i][j] is the common length of from[i:] and to[j:]
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if sameSection(from[i], to[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var changes []SectionChange
+	i, j := 0, 0
+	for i < len(from) || j < len(to) {
+		switch {
+		case i < len(from) && j < len(to) && sameSection(from[i], to[j]):
+			i++
+			j++
+		case i < len(from) && (j == len(to) || lcs[i+1][j] >= lcs[i][j+1]):
+			changes = append(changes, SectionChange{Op: "removed", From: &from[i], Index: j})
+			i++
+		default:
+			changes = append(changes, SectionChange{Op: "added", To: &to[j], Index: j})
+			j++
+		}
+	}
+	return pairChanges(changes)
+}
+
+func sameSection(a, b PageSection) bool {
+	return a.Type == b.Type && a.Content == b.Content && a.Language == b.Language
+}
+
+// pairChanges merges a removal directly followed by an addition of the same
+// section type, which is how an edited section shows up.
+func pairChanges(changes []SectionChange) []SectionChange {
+	var out []SectionChange
+	for k := 0; k < len(changes); k++ {
+		c := changes[k]
+		if c.Op == "removed" && k+1 < len(changes) {
+			next := changes[k+1]
+			if next.Op == "added" && next.Index == c.Index && next.To.Type == c.From.Type {
+				out = append(out, SectionChange{Op: "changed", From: c.From, To: next.To, Index: next.Index})
+				k++
+				continue
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
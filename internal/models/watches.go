@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// watch kinds
+const (
+	WatchPage   = "page"   // a url changed
+	WatchSymbol = "symbol" // the page documenting a symbol changed
+	WatchQuery  = "query"  // a new page matches a search
+)
+
+// Watch subscribes a user to changes. Events are always added to the user's
+// feed and also posted to WebhookURL when it is set.
+type Watch struct {
+	ID         int64     `json:"id"`
+	User       string    `json:"user"`
+	Kind       string    `json:"kind"`
+	Target     string    `json:"target"`
+	WebhookURL string    `json:"webhook_url,omitempty"`
+	// Secret signs webhook deliveries, it is only returned when the watch
+	// is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WatchEvent is one notification for a watch.
+type WatchEvent struct {
+	ID        int64     `json:"id"`
+	WatchID   int64     `json:"watch_id"`
+	Kind      string    `json:"kind"`
+	Target    string    `json:"target"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title"`
+	Version   int       `json:"version"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WatchDelivery is an event waiting to be posted to its watch's webhook.
+type WatchDelivery struct {
+	Event      WatchEvent
+	WebhookURL string
+	Secret     string
+	Attempts   int
+}
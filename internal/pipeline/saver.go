@@ -0,0 +1,84 @@
+package pipeline
+
+import (
+	"context"
+	"log"
+	"slices"
+
+	"oss/internal/models"
+	"oss/internal/quality"
+	"oss/internal/search"
+	"oss/internal/storage"
+)
+
+// DualSaver writes pages to the database and then indexes them in
+// elasticsearch. The database is the source of truth, so only its errors
+// are returned; a failed index can be repaired later with sync_store. Pages
+// scoring below MinQuality are kept in the database but removed from the
+// index.
+type DualSaver struct {
+	DB         storage.Store
+	ES         *search.Client
+	MinQuality float64
+}
+
+func (ds *DualSaver) SavePage(ctx context.Context, p models.ScrapedPage) error {
+	p.Quality = quality.Of(p)
+	if err := ds.DB.SavePage(ctx, p); err != nil {
+		return err
+	}
+	if p.Quality < ds.MinQuality {
+		ds.unindex(ctx, p)
+		return nil
+	}
+	if err := ds.ES.SavePage(ctx, p); err != nil {
+		log.Printf("Warning: Failed to index page %s: %v", p.URL, err)
+	}
+	return nil
+}
+
+// SavePages saves a batch of pages to the database and indexes those that
+// were saved, see SavePage. It returns the database error of each page.
+func (ds *DualSaver) SavePages(ctx context.Context, pages []models.ScrapedPage) []error {
+	pages = slices.Clone(pages)
+	for i := range pages {
+		pages[i].Quality = quality.Of(pages[i])
+	}
+	errs := ds.DB.SavePages(ctx, pages)
+
+	var index []models.ScrapedPage
+	for i, p := range pages {
+		if errs[i] != nil {
+			continue
+		}
+		if p.Quality < ds.MinQuality {
+			ds.unindex(ctx, p)
+			continue
+		}
+		index = append(index, p)
+	}
+	if len(index) == 0 {
+		return errs
+	}
+	for i, err := range ds.ES.SavePages(ctx, index) {
+		if err != nil {
+			log.Printf("Warning: Failed to index page %s: %v", index[i].URL, err)
+		}
+	}
+	return errs
+}
+
+// unindex drops a page that fell below MinQuality from the index, it may
+// have been indexed when it scored higher.
+func (ds *DualSaver) unindex(ctx context.Context, p models.ScrapedPage) {
+	log.Printf("Not indexing %s, quality %.2f is below %.2f", p.URL, p.Quality, ds.MinQuality)
+	if err := ds.ES.DeletePage(ctx, p.URL); err != nil {
+		log.Printf("Warning: Failed to remove page %s from the index: %v", p.URL, err)
+	}
+}
+
+// SaveSymbols stores symbols in the database only, they are looked up there
+// rather than searched.
+func (ds *DualSaver) SaveSymbols(ctx context.Context, symbols []models.Symbol) error {
+	return ds.DB.SaveSymbols(ctx, symbols)
+}
@@ -0,0 +1,83 @@
+package quality
+
+import (
+	"math"
+	"strings"
+
+	"oss/internal/models"
+)
+
+// Signals are the parts of the score that need the page's html. Sources
+// without html leave them zero.
+type Signals struct {
+	// LinkDensity is the share of the content text that sits inside links
+	LinkDensity float64
+	// Boilerplate is the share of the content text in nav, header, footer
+	// and similar elements
+	Boilerplate float64
+}
+
+// pages with this many words or more get the full length score
+const fullLength = 300
+
+var weights = struct {
+	length, mix, unique float64
+	// link density and boilerplate scale the whole score down
+	links, boilerplate float64
+}{0.6, 0.2, 0.2, 0.7, 0.5}
+
+// Score rates a page between 0 and 1. Thin pages such as index stubs,
+// redirect notices and generated listings score low: they are short, mostly
+// links or repeat the same lines.
+func Score(p models.ScrapedPage, s Signals) float64 {
+	var words, textChars, codeChars int
+	seen := map[string]bool{}
+	dups := 0
+	for _, sec := range p.Sections {
+		words += len(strings.Fields(sec.Content))
+		if sec.Type == "code" {
+			codeChars += len(sec.Content)
+		} else {
+			textChars += len(sec.Content)
+		}
+		key := strings.ToLower(strings.Join(strings.Fields(sec.Content), " "))
+		if seen[key] {
+			dups++
+		}
+		seen[key] = true
+	}
+	if words == 0 {
+		return 0
+	}
+
+	length := math.Min(1, float64(words)/fullLength)
+
+	// prose with examples is what people search docs for
+	mix := 0.8
+	switch {
+	case textChars > 0 && codeChars > 0:
+		mix = 1
+	case textChars == 0:
+		mix = 0.5
+	}
+
+	unique := 1 - float64(dups)/float64(len(p.Sections))
+
+	score := weights.length*length + weights.mix*mix + weights.unique*unique
+	score *= 1 - weights.links*clamp(s.LinkDensity)
+	score *= 1 - weights.boilerplate*clamp(s.Boilerplate)
+	return math.Round(score*1000) / 1000
+}
+
+// Of returns the page's stored score, scoring it from its sections when it
+// has none yet.
+func Of(p models.ScrapedPage) float64 {
+	if p.Quality > 0 {
+		return p.Quality
+	}
+	return Score(p, Signals{})
+}
+
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
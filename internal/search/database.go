@@ -0,0 +1,32 @@
+package search
+
+import (
+	"context"
+
+	"oss/internal/models"
+	"oss/internal/storage"
+)
+
+// Database searches the pages stored in the database with its own full-text
+// search, for when elasticsearch is unavailable. It returns pages in the
+// same shape as Client.Search. Pages scoring below MinQuality are left out,
+// as they are from the index.
+type Database struct {
+	Store      storage.Store
+	MinQuality float64
+}
+
+// Name is the backend reported with results, postgres or sqlite.
+func (d *Database) Name() string {
+	return d.Store.Dialect()
+}
+
+func (d *Database) Search(ctx context.Context, query string, filter Filter) ([]models.ScrapedPage, error) {
+	pages := storage.PageFilter{
+		Source:     filter.Source,
+		SourceID:   filter.SourceID,
+		MinQuality: d.MinQuality,
+		PublicOnly: filter.PublicOnly,
+	}
+	return d.Store.SearchPages(ctx, query, pages, searchSize)
+}
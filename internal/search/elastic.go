@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"oss/internal/models"
 	"strings"
 
@@ -54,7 +55,9 @@ func (c *Client) InitIndex(ctx context.Context, schemaJson []byte) error {
 	return nil
 }
 
-func (c *Client) SavePage(ctx context.Context, p models.ScrapedPage) error {
+// NewDocument flattens a page into the document stored in the pages index,
+// with text and code sections searched as separate fields.
+func NewDocument(p models.ScrapedPage) map[string]interface{} {
 	var codeBuilder strings.Builder
 	var textBuilder strings.Builder
 
@@ -66,15 +69,41 @@ func (c *Client) SavePage(ctx context.Context, p models.ScrapedPage) error {
 		}
 	}
 
-	doc := map[string]interface{}{
+	source := p.Source
+	if source == "" {
+		source = models.SourceWeb
+	}
+
+	var lastUpdated interface{}
+	if p.LastUpdated != "" {
+		lastUpdated = p.LastUpdated
+	}
+	var sourceID interface{}
+	if p.SourceID != 0 {
+		sourceID = p.SourceID
+	}
+
+	return map[string]interface{}{
 		"url":           p.URL,
 		"title":         p.Title,
 		"content":       textBuilder.String(),
 		"code_snippets": codeBuilder.String(),
 		"crawled_at":    p.CrawledAt,
+		"source":        source,
+		"tags":          p.Tags,
+		"votes":         p.Votes,
+		"description":   p.Description,
+		"breadcrumbs":   p.Breadcrumbs,
+		"last_updated":  lastUpdated,
+		"deprecated":    p.Deprecated != "",
+		"quality":       p.Quality,
+		"private":       p.Private,
+		"source_id":     sourceID,
 	}
+}
 
-	data, err := json.Marshal(doc)
+func (c *Client) SavePage(ctx context.Context, p models.ScrapedPage) error {
+	data, err := json.Marshal(NewDocument(p))
 	if err != nil {
 		return err
 	}
@@ -99,17 +128,148 @@ func (c *Client) SavePage(ctx context.Context, p models.ScrapedPage) error {
 	return nil
 }
 
-func (c *Client) Search(ctx context.Context, query string) ([]models.ScrapedPage, error) {
-	searchQuery := map[string]interface{}{
-		"size": 50,
-		"query": map[string]interface{}{
+// DeletePage removes a page from the index, a page that isn't indexed is not
+// an error.
+func (c *Client) DeletePage(ctx context.Context, url string) error {
+	req := esapi.DeleteRequest{
+		Index:      "pages",
+		DocumentID: url,
+		Refresh:    "true",
+	}
+
+	res, err := req.Do(ctx, c.es)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("error deleting: %s", res.String())
+	}
+
+	return nil
+}
+
+// SavePages indexes pages with one bulk request and returns why each page
+// failed, nil for those indexed.
+func (c *Client) SavePages(ctx context.Context, pages []models.ScrapedPage) []error {
+	errs := make([]error, len(pages))
+	var body bytes.Buffer
+	for _, p := range pages {
+		action, _ := json.Marshal(map[string]any{"index": map[string]any{"_index": "pages", "_id": p.URL}})
+		doc, err := json.Marshal(NewDocument(p))
+		if err != nil {
+			return fillErrors(errs, err)
+		}
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc)
+		body.WriteByte('\n')
+	}
+
+	req := esapi.BulkRequest{
+		Body:    &body,
+		Refresh: "true",
+	}
+	res, err := req.Do(ctx, c.es)
+	if err != nil {
+		return fillErrors(errs, err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fillErrors(errs, fmt.Errorf("error indexing: %s", res.String()))
+	}
+
+	var bulk struct {
+		Items []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&bulk); err != nil {
+		return fillErrors(errs, err)
+	}
+	for i, item := range bulk.Items {
+		if i < len(errs) && item["index"].Status >= 300 {
+			errs[i] = fmt.Errorf("error indexing: %s", item["index"].Error)
+		}
+	}
+	return errs
+}
+
+func fillErrors(errs []error, err error) []error {
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+// candidates returned by a search, before reranking
+const searchSize = 50
+
+// deprecated pages still match, their score is scaled by this
+const deprecatedBoost = 0.3
+
+// quality assumed for documents indexed before pages were scored
+const qualityMissing = 0.5
+
+// Filter narrows a search, zero values match everything.
+type Filter struct {
+	Source string
+	// SourceID is a registered source, see models.Source
+	SourceID int64
+	// PublicOnly leaves out private pages, for unauthenticated callers
+	PublicOnly bool
+}
+
+func (c *Client) Search(ctx context.Context, query string, filter Filter) ([]models.ScrapedPage, error) {
+	boolQuery := map[string]interface{}{
+		"must": map[string]interface{}{
 			"multi_match": map[string]interface{}{
 				"query":     query,
-				"fields":    []string{"title^3", "code_snippets^2", "content"},
+				"fields":    []string{"title^3", "code_snippets^2", "description^2", "breadcrumbs", "content"},
 				"fuzziness": "AUTO",
 			},
 		},
 	}
+	var filters []interface{}
+	if filter.Source != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"source": filter.Source}})
+	}
+	if filter.SourceID != 0 {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"source_id": filter.SourceID}})
+	}
+	if len(filters) > 0 {
+		boolQuery["filter"] = filters
+	}
+	if filter.PublicOnly {
+		// documents indexed before pages could be private have no flag
+		boolQuery["must_not"] = map[string]interface{}{"term": map[string]interface{}{"private": true}}
+	}
+
+	searchQuery := map[string]interface{}{
+		"size": searchSize,
+		"query": map[string]interface{}{
+			"boosting": map[string]interface{}{
+				"positive": map[string]interface{}{
+					// log10(2 + quality), a gentle boost for substantial pages
+					"function_score": map[string]interface{}{
+						"query": map[string]interface{}{"bool": boolQuery},
+						"field_value_factor": map[string]interface{}{
+							"field":    "quality",
+							"modifier": "log2p",
+							"missing":  qualityMissing,
+						},
+						"boost_mode": "multiply",
+					},
+				},
+				"negative": map[string]interface{}{
+					"term": map[string]interface{}{"deprecated": true},
+				},
+				"negative_boost": deprecatedBoost,
+			},
+		},
+	}
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(searchQuery)
 	if err != nil {
@@ -145,10 +305,27 @@ func (c *Client) Search(ctx context.Context, query string) ([]models.ScrapedPage
 			URL:   source["url"].(string),
 			Title: source["title"].(string),
 			Sections: []models.PageSection{
-				{Content: fmt.Sprintf("%v", source["content"])[:200] + "..."},
+				{Content: models.Truncate(fmt.Sprintf("%v", source["content"]), 200)},
 			},
 		}
+		page.Source, _ = source["source"].(string)
+		page.Description, _ = source["description"].(string)
+		page.LastUpdated, _ = source["last_updated"].(string)
+		page.Quality, _ = source["quality"].(float64)
+		page.Private, _ = source["private"].(bool)
+		if id, ok := source["source_id"].(float64); ok {
+			page.SourceID = int64(id)
+		}
+		if crumbs, ok := source["breadcrumbs"].([]interface{}); ok {
+			for _, c := range crumbs {
+				page.Breadcrumbs = append(page.Breadcrumbs, fmt.Sprint(c))
+			}
+		}
+		if deprecated, _ := source["deprecated"].(bool); deprecated {
+			// the index only keeps the flag, not the notice
+			page.Deprecated = "deprecated"
+		}
 		results = append(results, page)
 	}
 	return results, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"oss/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// pageRow is a page encoded for SavePages, so a page that can't be encoded
+// fails on its own rather than with its batch.
+type pageRow struct {
+	// index of the page in the SavePages argument
+	index    int
+	page     models.ScrapedPage
+	sections [][]any
+	hash     string
+	snapshot []byte
+}
+
+func newPageRow(index int, p models.ScrapedPage) (pageRow, error) {
+	row := pageRow{index: index, page: p}
+	for i, section := range p.Sections {
+		data, err := sectionData(section)
+		if err != nil {
+			return row, fmt.Errorf("failed to encode section %v: %v", i, err)
+		}
+		row.sections = append(row.sections, []any{section.Type, section.Content, section.Language, i, data})
+	}
+	var err error
+	if row.hash, err = contentHash(p); err != nil {
+		return row, err
+	}
+	row.snapshot, err = json.Marshal(p)
+	return row, err
+}
+
+// pageRows encodes pages for a batch, ordered by url. A url given more than
+// once is only saved with its last page, the earlier ones count as saved.
+func pageRows(pages []models.ScrapedPage, errs []error) []pageRow {
+	last := map[string]int{}
+	for i, p := range pages {
+		last[p.URL] = i
+	}
+	var rows []pageRow
+	for i, p := range pages {
+		if last[p.URL] != i {
+			continue
+		}
+		row, err := newPageRow(i, p)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		rows = append(rows, row)
+	}
+	// concurrent batches lock their pages in the same order, so they can't
+	// deadlock
+	slices.SortFunc(rows, func(a, b pageRow) int { return strings.Compare(a.page.URL, b.page.URL) })
+	return rows
+}
+
+// SavePages saves many pages at once, with the same effect as SavePage for
+// each but far fewer round trips: the pages are upserted in one batch and
+// their sections and versions written with COPY, all in one transaction.
+// It returns why each page failed to save, nil for those saved. One bad
+// page fails the whole transaction, so the pages are then saved one at a
+// time to find out which.
+func (db *DB) SavePages(ctx context.Context, pages []models.ScrapedPage) []error {
+	errs := make([]error, len(pages))
+	rows := pageRows(pages, errs)
+	if len(rows) == 0 {
+		return errs
+	}
+	if err := db.savePageRows(ctx, rows); err == nil {
+		return errs
+	}
+	for _, row := range rows {
+		errs[row.index] = db.SavePage(ctx, row.page)
+	}
+	return errs
+}
+
+func (db *DB) savePageRows(ctx context.Context, rows []pageRow) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	upserts := &pgx.Batch{}
+	for _, row := range rows {
+		upserts.Queue(upsertPageQuery, upsertPageArgs(row.page, now)...)
+	}
+	results := tx.SendBatch(ctx, upserts)
+	ids := make([]int64, len(rows))
+	inserted := make([]bool, len(rows))
+	for i := range rows {
+		if err := results.QueryRow().Scan(&ids[i], &inserted[i]); err != nil {
+			results.Close()
+			return fmt.Errorf("failed to save page %s: %v", rows[i].page.URL, err)
+		}
+	}
+	if err := results.Close(); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM sections WHERE page_id = ANY($1)`, ids)
+	if err != nil {
+		return fmt.Errorf("failed to delete old sections: %v", err)
+	}
+	var sections [][]any
+	for i, row := range rows {
+		for _, section := range row.sections {
+			sections = append(sections, append([]any{ids[i]}, section...))
+		}
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"sections"},
+		[]string{"page_id", "section_type", "content", "language", "sort_order", "data"},
+		pgx.CopyFromRows(sections))
+	if err != nil {
+		return fmt.Errorf("failed to copy sections: %v", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE pages SET search_vector = page_search_vector(id) WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return fmt.Errorf("failed to index page text: %v", err)
+	}
+
+	if err := db.saveVersions(ctx, tx, ids, inserted, rows, now); err != nil {
+		return fmt.Errorf("failed to save page versions: %v", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// saveVersions snapshots the pages whose content changed, drops versions
+// beyond the retention limit and records the watch events the new versions
+// trigger, see saveVersion. inserted tells which pages are new rows.
+func (db *DB) saveVersions(ctx context.Context, tx pgx.Tx, ids []int64, inserted []bool, rows []pageRow, now time.Time) error {
+	type latest struct {
+		version int
+		hash    string
+	}
+	versions := map[int64]latest{}
+	found, err := tx.Query(ctx, `
+		SELECT DISTINCT ON (page_id) page_id, version, hash
+		FROM page_versions WHERE page_id = ANY($1)
+		ORDER BY page_id, version DESC
+	`, ids)
+	if err != nil {
+		return err
+	}
+	for found.Next() {
+		var id int64
+		var v latest
+		if err := found.Scan(&id, &v.version, &v.hash); err != nil {
+			found.Close()
+			return err
+		}
+		versions[id] = v
+	}
+	found.Close()
+	if err := found.Err(); err != nil {
+		return err
+	}
+
+	var snapshots [][]any
+	var changedIDs []int64
+	var changedVersions []int
+	watches := &pgx.Batch{}
+	for i, row := range rows {
+		v := versions[ids[i]]
+		if v.hash == row.hash {
+			continue
+		}
+		snapshots = append(snapshots, []any{ids[i], v.version + 1, row.page.Title, row.hash, row.snapshot, now})
+		changedIDs = append(changedIDs, ids[i])
+		changedVersions = append(changedVersions, v.version+1)
+		if v.version > 0 || inserted[i] {
+			queueWatchEvents(watches, row.page, v.version+1)
+		}
+	}
+	if len(snapshots) == 0 {
+		return nil
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"page_versions"},
+		[]string{"page_id", "version", "title", "hash", "snapshot", "created_at"},
+		pgx.CopyFromRows(snapshots))
+	if err != nil {
+		return err
+	}
+
+	keep := db.KeepVersions
+	if keep <= 0 {
+		keep = DefaultKeepVersions
+	}
+	_, err = tx.Exec(ctx, `
+		DELETE FROM page_versions v
+		USING unnest($1::int[], $2::int[]) AS k(page_id, version)
+		WHERE v.page_id = k.page_id AND v.version <= k.version - $3
+	`, changedIDs, changedVersions, keep)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.SendBatch(ctx, watches).Close(); err != nil {
+		return fmt.Errorf("failed to match watches: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Checkpoint returns the time a named sync last covered pages up to, zero
+// if it never completed.
+func (db *DB) Checkpoint(ctx context.Context, name string) (time.Time, error) {
+	var at time.Time
+	err := db.Pool.QueryRow(ctx, `SELECT synced_at FROM sync_checkpoints WHERE name = $1`, name).Scan(&at)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return at, err
+}
+
+// SaveCheckpoint records that a named sync covered pages saved up to at.
+func (db *DB) SaveCheckpoint(ctx context.Context, name string, at time.Time) error {
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO sync_checkpoints (name, synced_at) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET synced_at = EXCLUDED.synced_at, updated_at = now()
+	`, name, at)
+	return err
+}
@@ -0,0 +1,353 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"oss/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// The frontier is shared by every crawl worker. Urls are leased rather than
+// locked for the length of a fetch, so a worker that dies only holds its urls
+// until the lease runs out. Politeness is kept in crawl_domains: claiming a
+// url locks its domain row and pushes next_fetch_at forward, so at most one
+// worker fetches from a domain per delay, however many workers there are.
+
+func urlDomain(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("url %q has no host", raw)
+	}
+	return strings.ToLower(u.Hostname()), nil
+}
+
+// SeedFrontier allows crawling domains, with delay between fetches from each,
+// and queues the start urls. Start urls are queued again even if they were
+// crawled before. With recrawl every finished url is queued again too.
+func (db *DB) SeedFrontier(ctx context.Context, domains, urls []string, delay time.Duration, recrawl bool) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, d := range domains {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO crawl_domains (domain, delay_ms) VALUES ($1, $2)
+			ON CONFLICT (domain) DO UPDATE SET delay_ms = EXCLUDED.delay_ms
+		`, strings.ToLower(d), delay.Milliseconds())
+		if err != nil {
+			return fmt.Errorf("failed to save domain %s: %v", d, err)
+		}
+	}
+	for _, u := range urls {
+		domain, err := urlDomain(u)
+		if err != nil {
+			return err
+		}
+		// a start url's own domain is always allowed
+		_, err = tx.Exec(ctx, `
+			INSERT INTO crawl_domains (domain, delay_ms) VALUES ($1, $2)
+			ON CONFLICT (domain) DO NOTHING
+		`, domain, delay.Milliseconds())
+		if err != nil {
+			return fmt.Errorf("failed to save domain %s: %v", domain, err)
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO frontier (url, domain, depth) VALUES ($1, $2, 0)
+			ON CONFLICT (url) DO UPDATE SET status = 'pending', attempts = 0, depth = 0
+			WHERE frontier.status <> 'leased'
+		`, u, domain)
+		if err != nil {
+			return fmt.Errorf("failed to queue %s: %v", u, err)
+		}
+	}
+	if recrawl {
+		_, err := tx.Exec(ctx, `
+			UPDATE frontier SET status = 'pending', attempts = 0, updated_at = now()
+			WHERE status IN ('done', 'failed')
+		`)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// Enqueue adds discovered urls. Urls already in the frontier and urls on
+// domains that weren't seeded are ignored.
+func (db *DB) Enqueue(ctx context.Context, urls []string, depth int) error {
+	var keep, domains []string
+	for _, u := range urls {
+		domain, err := urlDomain(u)
+		if err != nil {
+			continue
+		}
+		keep = append(keep, u)
+		domains = append(domains, domain)
+	}
+	if len(keep) == 0 {
+		return nil
+	}
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO frontier (url, domain, depth)
+		SELECT u.url, u.domain, $3
+		FROM unnest($1::text[], $2::text[]) AS u(url, domain)
+		JOIN crawl_domains d ON d.domain = u.domain
+		ON CONFLICT (url) DO NOTHING
+	`, keep, domains, depth)
+	return err
+}
+
+// allowSourceDomainsQuery lets the frontier crawl those of the domains $1
+// that an enabled registered source covers, with the default delay. Sites
+// crawled with cmd/crawler were never seeded into the frontier.
+const allowSourceDomainsQuery = `
+	INSERT INTO crawl_domains (domain)
+	SELECT DISTINCT d.domain
+	FROM unnest($1::text[]) AS d(domain)
+	JOIN sources s ON s.enabled AND d.domain = ANY (s.domains)
+	ON CONFLICT (domain) DO NOTHING
+`
+
+// RequestRecrawl queues urls ahead of the normal crawl order, whether or not
+// they were crawled before, and returns the ones queued. Urls on domains that
+// weren't seeded or registered as a source and urls being fetched right now
+// are left out.
+func (db *DB) RequestRecrawl(ctx context.Context, urls []string, priority int) ([]string, error) {
+	var keep, domains []string
+	for _, u := range urls {
+		domain, err := urlDomain(u)
+		if err != nil {
+			continue
+		}
+		keep = append(keep, u)
+		domains = append(domains, domain)
+	}
+	if len(keep) == 0 {
+		return nil, nil
+	}
+	if _, err := db.Pool.Exec(ctx, allowSourceDomainsQuery, domains); err != nil {
+		return nil, err
+	}
+	rows, err := db.Pool.Query(ctx, `
+		INSERT INTO frontier (url, domain, depth, priority)
+		SELECT u.url, u.domain, 0, $3
+		FROM unnest($1::text[], $2::text[]) AS u(url, domain)
+		JOIN crawl_domains d ON d.domain = u.domain
+		ON CONFLICT (url) DO UPDATE SET status = 'pending', attempts = 0,
+			priority = EXCLUDED.priority, updated_at = now()
+		WHERE frontier.status <> 'leased'
+		RETURNING url
+	`, keep, domains, priority)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var queued []string
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			return nil, err
+		}
+		queued = append(queued, u)
+	}
+	return queued, rows.Err()
+}
+
+// RequestDomainRecrawl queues every crawled url of a domain again, ahead of
+// the normal crawl order, and returns how many were queued. Pages saved by
+// crawls outside the frontier are queued too, if the domain is seeded or
+// registered as a source.
+func (db *DB) RequestDomainRecrawl(ctx context.Context, domain string, priority int) (int, error) {
+	domain = strings.ToLower(domain)
+	if _, err := db.Pool.Exec(ctx, allowSourceDomainsQuery, []string{domain}); err != nil {
+		return 0, err
+	}
+	requeued, err := db.Pool.Exec(ctx, `
+		UPDATE frontier SET status = 'pending', attempts = 0, priority = $2, updated_at = now()
+		WHERE domain = $1 AND status IN ('done', 'failed')
+	`, domain, priority)
+	if err != nil {
+		return 0, err
+	}
+	added, err := db.Pool.Exec(ctx, `
+		INSERT INTO frontier (url, domain, depth, priority)
+		SELECT p.url, d.domain, 0, $2
+		FROM pages p
+		JOIN crawl_domains d ON d.domain = $1
+		WHERE starts_with(p.url, 'https://' || $1 || '/') OR starts_with(p.url, 'http://' || $1 || '/')
+		ON CONFLICT (url) DO NOTHING
+	`, domain, priority)
+	if err != nil {
+		return 0, err
+	}
+	return int(requeued.RowsAffected() + added.RowsAffected()), nil
+}
+
+// Claim leases the next url whose domain may be fetched now, nil if there is
+// none. Urls whose lease expired are claimable again.
+func (db *DB) Claim(ctx context.Context, worker string, lease time.Duration) (*models.FrontierURL, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	next := &models.FrontierURL{}
+	err = tx.QueryRow(ctx, `
+		SELECT f.id, f.url, f.domain, f.depth, f.attempts
+		FROM frontier f
+		JOIN crawl_domains d ON d.domain = f.domain
+		WHERE (f.status = 'pending' OR (f.status = 'leased' AND f.lease_expires < now()))
+			AND d.next_fetch_at <= now()
+		ORDER BY f.priority DESC, f.depth, f.id
+		LIMIT 1
+		FOR UPDATE OF f, d SKIP LOCKED
+	`).Scan(&next.ID, &next.URL, &next.Domain, &next.Depth, &next.Attempts)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE frontier
+		SET status = 'leased', lease_owner = $2, lease_expires = now() + make_interval(secs => $3),
+			attempts = attempts + 1, updated_at = now()
+		WHERE id = $1
+	`, next.ID, worker, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE crawl_domains SET next_fetch_at = now() + make_interval(secs => delay_ms / 1000.0)
+		WHERE domain = $1
+	`, next.Domain)
+	if err != nil {
+		return nil, err
+	}
+	next.Attempts++
+	return next, tx.Commit(ctx)
+}
+
+// Complete marks a leased url as crawled. It is a no-op if the lease was
+// lost to another worker in the meantime.
+func (db *DB) Complete(ctx context.Context, id int64, worker string) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE frontier
+		SET status = 'done', lease_owner = NULL, lease_expires = NULL, last_error = NULL, priority = 0,
+			updated_at = now()
+		WHERE id = $1 AND lease_owner = $2
+	`, id, worker)
+	return err
+}
+
+// Fail returns a leased url to the frontier, or gives up on it once it has
+// been tried maxAttempts times.
+func (db *DB) Fail(ctx context.Context, id int64, worker, reason string, maxAttempts int) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE frontier
+		SET status = CASE WHEN attempts >= $4 THEN 'failed' ELSE 'pending' END,
+			lease_owner = NULL, lease_expires = NULL, last_error = $3, updated_at = now()
+		WHERE id = $1 AND lease_owner = $2
+	`, id, worker, reason, maxAttempts)
+	return err
+}
+
+// Outstanding counts the urls not yet crawled, leased ones included.
+func (db *DB) Outstanding(ctx context.Context) (int, error) {
+	var n int
+	err := db.Pool.QueryRow(ctx, `SELECT count(*) FROM frontier WHERE status IN ('pending', 'leased')`).Scan(&n)
+	return n, err
+}
+
+// FrontierCounts returns the number of urls in each status.
+func (db *DB) FrontierCounts(ctx context.Context) (map[string]int, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT status, count(*) FROM frontier GROUP BY status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// Heartbeat records that a worker is alive and extends the leases it holds.
+func (db *DB) Heartbeat(ctx context.Context, w models.Worker, lease time.Duration) error {
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO crawl_workers (id, host, started_at, heartbeat_at, current_url, fetched)
+		VALUES ($1, $2, $3, now(), $4, $5)
+		ON CONFLICT (id) DO UPDATE SET heartbeat_at = now(), current_url = EXCLUDED.current_url,
+			fetched = EXCLUDED.fetched, stopped_at = NULL
+	`, w.ID, w.Host, w.StartedAt, w.CurrentURL, w.Fetched)
+	if err != nil {
+		return err
+	}
+	_, err = db.Pool.Exec(ctx, `
+		UPDATE frontier SET lease_expires = now() + make_interval(secs => $2)
+		WHERE lease_owner = $1 AND status = 'leased'
+	`, w.ID, lease.Seconds())
+	return err
+}
+
+// Release hands a stopping worker's leases back to the frontier and marks it
+// stopped.
+func (db *DB) Release(ctx context.Context, worker string) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE frontier SET status = 'pending', lease_owner = NULL, lease_expires = NULL, updated_at = now()
+		WHERE lease_owner = $1 AND status = 'leased'
+	`, worker)
+	if err != nil {
+		return err
+	}
+	_, err = db.Pool.Exec(ctx, `UPDATE crawl_workers SET stopped_at = now() WHERE id = $1`, worker)
+	return err
+}
+
+// ListWorkers returns workers seen within the last day, a worker counts as
+// alive if it hasn't stopped and sent a heartbeat within staleAfter.
+func (db *DB) ListWorkers(ctx context.Context, staleAfter time.Duration) ([]models.Worker, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, COALESCE(host, ''), started_at, heartbeat_at, stopped_at, COALESCE(current_url, ''), fetched,
+			stopped_at IS NULL AND heartbeat_at > now() - make_interval(secs => $1)
+		FROM crawl_workers
+		WHERE heartbeat_at > now() - interval '1 day'
+		ORDER BY started_at DESC
+	`, staleAfter.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workers := []models.Worker{}
+	for rows.Next() {
+		var w models.Worker
+		err := rows.Scan(&w.ID, &w.Host, &w.StartedAt, &w.HeartbeatAt, &w.StoppedAt, &w.CurrentURL, &w.Fetched, &w.Alive)
+		if err != nil {
+			return nil, err
+		}
+		workers = append(workers, w)
+	}
+	return workers, rows.Err()
+}
@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+// migrationLock is the advisory lock key held while migrating, so two
+// migrate runs can't apply the same migration.
+const migrationLock = 7461293
+
+// ErrSchemaOutdated is returned by CheckSchema when migrations are pending.
+var ErrSchemaOutdated = errors.New("database schema is out of date")
+
+// Migration is one schema change, read from migrations/NNNN_name.up.sql and
+// its matching .down.sql. SQLite has its own set in migrations/sqlite.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a known migration and when it was applied, nil if it's
+// pending.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrations returns the embedded postgres migrations ordered by version.
+func Migrations() ([]Migration, error) {
+	return readMigrations("migrations")
+}
+
+func readMigrations(dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		base, direction, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), ".")
+		num, name, found := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || !found || err != nil || version <= 0 {
+			return nil, fmt.Errorf("bad migration file name %q", e.Name())
+		}
+		data, err := migrationFiles.ReadFile(path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has two names, %q and %q", version, m.Name, name)
+		}
+		switch direction {
+		case "up":
+			m.Up = string(data)
+		case "down":
+			m.Down = string(data)
+		default:
+			return nil, fmt.Errorf("bad migration file name %q", e.Name())
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d (%s) needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// querier is what reading the migration table needs; a pool or a single
+// connection both do.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// appliedMigrations returns when each applied migration ran. A database
+// that has never been migrated has none.
+func appliedMigrations(ctx context.Context, q querier) (map[int]time.Time, error) {
+	rows, err := q.Query(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	exists, err := pgx.CollectExactlyOneRow(rows, pgx.RowTo[bool])
+	if err != nil || !exists {
+		return map[int]time.Time{}, err
+	}
+
+	rows, err = q.Query(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// MigrationStatus lists every embedded migration with when it was applied.
+func (db *DB) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(ctx, db.Pool)
+	if err != nil {
+		return nil, err
+	}
+	return migrationStatus(migrations, applied), nil
+}
+
+// CheckSchema fails unless every embedded migration has been applied and
+// the database has none this build doesn't know about. Commands call it at
+// startup so they never run against a schema they weren't written for.
+func (db *DB) CheckSchema(ctx context.Context) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(ctx, db.Pool)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %v", err)
+	}
+	return checkSchema(migrations, applied)
+}
+
+func migrationStatus(migrations []Migration, applied map[int]time.Time) []MigrationStatus {
+	status := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		status[i].Migration = m
+		if at, ok := applied[m.Version]; ok {
+			status[i].AppliedAt = &at
+		}
+	}
+	return status
+}
+
+func checkSchema(migrations []Migration, applied map[int]time.Time) error {
+	pending := 0
+	unknown := len(applied)
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			unknown--
+		} else {
+			pending++
+		}
+	}
+	if unknown > 0 {
+		return fmt.Errorf("database has %d migrations this build doesn't know, upgrade the binary", unknown)
+	}
+	if pending > 0 {
+		return fmt.Errorf("%w: %d pending migrations, run `migrate up`", ErrSchemaOutdated, pending)
+	}
+	return nil
+}
+
+// Migrate applies pending migrations up to and including version target,
+// or all of them when target is 0, each in its own transaction. It returns
+// the migrations it applied.
+func (db *DB) Migrate(ctx context.Context, target int) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	err = db.withMigrationLock(ctx, func(conn *pgxpool.Conn, applied map[int]time.Time) error {
+		for _, m := range migrations {
+			if target > 0 && m.Version > target {
+				break
+			}
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			err := runMigration(ctx, conn, m.Up,
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+			if err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Name, err)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Rollback reverts the latest steps applied migrations, newest first, and
+// returns the ones it reverted.
+func (db *DB) Rollback(ctx context.Context, steps int) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	err = db.withMigrationLock(ctx, func(conn *pgxpool.Conn, applied map[int]time.Time) error {
+		for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			err := runMigration(ctx, conn, m.Down,
+				`DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+			if err != nil {
+				return fmt.Errorf("rollback of %d (%s) failed: %v", m.Version, m.Name, err)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// withMigrationLock runs fn on one connection holding the migration lock,
+// with the migration table created and its rows loaded.
+func (db *DB) withMigrationLock(ctx context.Context, fn func(*pgxpool.Conn, map[int]time.Time) error) error {
+	conn, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLock); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLock)
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn, applied)
+}
+
+// runMigration runs a migration script and its schema_migrations
+// bookkeeping in one transaction.
+func runMigration(ctx context.Context, conn *pgxpool.Conn, script, record string, args ...any) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Without arguments pgx uses the simple protocol, which accepts a
+	// script of several statements.
+	if _, err := tx.Exec(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS symbols;
+DROP TABLE IF EXISTS sections;
+DROP TABLE IF EXISTS pages;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS pages (
+    id SERIAL PRIMARY KEY,
+    url TEXT UNIQUE NOT NULL,
+    title TEXT,
+    crawled_at TIMESTAMP with TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS sections (
+    id SERIAL PRIMARY KEY,
+    page_id INTEGER REFERENCES pages(id) ON DELETE CASCADE,
+    section_type TEXT,
+    content TEXT,
+    language TEXT,
+    sort_order INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS symbols (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    domain TEXT NOT NULL,
+    role TEXT NOT NULL,
+    url TEXT NOT NULL,
+    display_name TEXT,
+    project TEXT,
+    version TEXT,
+    priority INTEGER,
+    UNIQUE (name, domain, role, url)
+);
+
+CREATE INDEX IF NOT EXISTS symbols_name_idx ON symbols (lower(name));
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS pages_source_idx;
+
+ALTER TABLE pages DROP COLUMN IF EXISTS votes;
+ALTER TABLE pages DROP COLUMN IF EXISTS tags;
+ALTER TABLE pages DROP COLUMN IF EXISTS source;
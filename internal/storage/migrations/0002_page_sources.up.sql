@@ -0,0 +1,5 @@
+ALTER TABLE pages ADD COLUMN IF NOT EXISTS source TEXT;
+ALTER TABLE pages ADD COLUMN IF NOT EXISTS tags TEXT[];
+ALTER TABLE pages ADD COLUMN IF NOT EXISTS votes INTEGER;
+
+CREATE INDEX IF NOT EXISTS pages_source_idx ON pages (source);
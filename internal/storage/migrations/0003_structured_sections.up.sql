@@ -0,0 +1 @@
+ALTER TABLE sections ADD COLUMN IF NOT EXISTS data JSONB;
@@ -0,0 +1,5 @@
+ALTER TABLE pages DROP COLUMN IF EXISTS deprecated;
+ALTER TABLE pages DROP COLUMN IF EXISTS last_updated;
+ALTER TABLE pages DROP COLUMN IF EXISTS breadcrumbs;
+ALTER TABLE pages DROP COLUMN IF EXISTS opengraph;
+ALTER TABLE pages DROP COLUMN IF EXISTS description;
@@ -0,0 +1,5 @@
+ALTER TABLE pages ADD COLUMN IF NOT EXISTS description TEXT;
+ALTER TABLE pages ADD COLUMN IF NOT EXISTS opengraph JSONB;
+ALTER TABLE pages ADD COLUMN IF NOT EXISTS breadcrumbs TEXT[];
+ALTER TABLE pages ADD COLUMN IF NOT EXISTS last_updated DATE;
+ALTER TABLE pages ADD COLUMN IF NOT EXISTS deprecated TEXT;
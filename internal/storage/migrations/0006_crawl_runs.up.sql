@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS crawl_runs (
+    id BIGSERIAL PRIMARY KEY,
+    source TEXT NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ NOT NULL,
+    fetched INTEGER NOT NULL DEFAULT 0,
+    saved INTEGER NOT NULL DEFAULT 0,
+    skipped INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    statuses JSONB,
+    errors JSONB,
+    slow_urls JSONB
+);
+
+CREATE INDEX IF NOT EXISTS crawl_runs_started_idx ON crawl_runs (source, started_at DESC);
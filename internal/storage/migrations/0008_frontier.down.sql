@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS crawl_workers;
+DROP TABLE IF EXISTS frontier;
+DROP TABLE IF EXISTS crawl_domains;
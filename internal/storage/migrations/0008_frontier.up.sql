@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS crawl_domains (
+    domain TEXT PRIMARY KEY,
+    delay_ms INTEGER NOT NULL DEFAULT 1000,
+    next_fetch_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS frontier (
+    id BIGSERIAL PRIMARY KEY,
+    url TEXT UNIQUE NOT NULL,
+    domain TEXT NOT NULL REFERENCES crawl_domains(domain),
+    depth INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    lease_owner TEXT,
+    lease_expires TIMESTAMPTZ,
+    last_error TEXT,
+    added_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS frontier_claim_idx ON frontier (status, depth, id);
+CREATE INDEX IF NOT EXISTS frontier_lease_idx ON frontier (lease_owner) WHERE status = 'leased';
+
+CREATE TABLE IF NOT EXISTS crawl_workers (
+    id TEXT PRIMARY KEY,
+    host TEXT,
+    started_at TIMESTAMPTZ NOT NULL,
+    heartbeat_at TIMESTAMPTZ NOT NULL,
+    stopped_at TIMESTAMPTZ,
+    current_url TEXT,
+    fetched INTEGER NOT NULL DEFAULT 0
+);
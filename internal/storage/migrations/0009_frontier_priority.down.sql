@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS frontier_priority_idx;
+
+ALTER TABLE frontier DROP COLUMN IF EXISTS priority;
@@ -0,0 +1,3 @@
+ALTER TABLE frontier ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS frontier_priority_idx ON frontier (status, priority DESC, depth, id);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS page_versions (
+    id BIGSERIAL PRIMARY KEY,
+    page_id INTEGER NOT NULL REFERENCES pages(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    title TEXT,
+    hash TEXT NOT NULL,
+    snapshot JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    UNIQUE (page_id, version)
+);
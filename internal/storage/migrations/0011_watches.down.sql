@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS symbols_page_idx;
+DROP TABLE IF EXISTS watch_events;
+DROP TABLE IF EXISTS watches;
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS watches (
+    id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    target TEXT NOT NULL,
+    webhook_url TEXT,
+    secret TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS watches_user_idx ON watches (user_id);
+CREATE INDEX IF NOT EXISTS watches_target_idx ON watches (kind, target);
+
+CREATE TABLE IF NOT EXISTS watch_events (
+    id BIGSERIAL PRIMARY KEY,
+    watch_id BIGINT NOT NULL REFERENCES watches(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    title TEXT,
+    version INTEGER NOT NULL,
+    message TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    delivered_at TIMESTAMPTZ,
+    last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS watch_events_watch_idx ON watch_events (watch_id, id);
+CREATE INDEX IF NOT EXISTS watch_events_pending_idx ON watch_events (next_attempt_at) WHERE delivered_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS symbols_page_idx ON symbols (split_part(url, '#', 1));
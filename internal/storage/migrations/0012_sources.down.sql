@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS pages_source_id_idx;
+
+ALTER TABLE pages DROP COLUMN IF EXISTS source_id;
+
+DROP TABLE IF EXISTS sources;
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS sources (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL,
+    domains TEXT[] NOT NULL,
+    seeds TEXT[] NOT NULL,
+    settings JSONB NOT NULL DEFAULT '{}',
+    owner TEXT,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS sources_domains_idx ON sources USING GIN (domains);
+
+-- the site the crawler used to have compiled in
+INSERT INTO sources (name, domains, seeds, settings)
+VALUES (
+    'pytorch',
+    ARRAY['pytorch.org', 'docs.pytorch.org'],
+    ARRAY['https://pytorch.org/docs/stable/index.html'],
+    '{"delay_ms": 1000, "parallelism": 4, "inventories": ["https://pytorch.org/docs/stable/objects.inv"]}'
+)
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE pages ADD COLUMN IF NOT EXISTS source_id BIGINT REFERENCES sources(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS pages_source_id_idx ON pages (source_id);
+
+UPDATE pages p SET source_id = s.id
+FROM sources s
+WHERE p.source_id IS NULL
+    AND COALESCE(p.source, 'web') = 'web'
+    AND lower(split_part(split_part(p.url, '://', 2), '/', 1)) = ANY (s.domains);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS pages_crawled_at_idx;
+
+DROP TABLE IF EXISTS sync_checkpoints;
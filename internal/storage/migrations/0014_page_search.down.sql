@@ -0,0 +1,4 @@
+DROP FUNCTION IF EXISTS page_search_vector(INTEGER);
+DROP INDEX IF EXISTS pages_search_idx;
+
+ALTER TABLE pages DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,22 @@
+ALTER TABLE pages ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+CREATE INDEX IF NOT EXISTS pages_search_idx ON pages USING GIN (search_vector);
+
+-- the full-text document of a page: the title weighs most, then the
+-- description and code, then prose. Section text is capped so large pages
+-- stay under the tsvector size limit.
+CREATE OR REPLACE FUNCTION page_search_vector(pid INTEGER) RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('english', COALESCE(p.title, '')), 'A')
+        || setweight(to_tsvector('english', COALESCE(p.description, '')), 'B')
+        || setweight(to_tsvector('english', left(COALESCE((
+            SELECT string_agg(content, ' ') FROM sections
+            WHERE page_id = pid AND section_type = 'code'
+        ), ''), 262144)), 'B')
+        || setweight(to_tsvector('english', left(COALESCE((
+            SELECT string_agg(content, ' ') FROM sections
+            WHERE page_id = pid AND COALESCE(section_type, '') <> 'code'
+        ), ''), 262144)), 'C')
+    FROM pages p WHERE p.id = pid
+$$ LANGUAGE sql STABLE;
+
+UPDATE pages SET search_vector = page_search_vector(id);
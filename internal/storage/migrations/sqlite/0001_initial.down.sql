@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS sync_checkpoints;
+DROP TABLE IF EXISTS watch_events;
+DROP TABLE IF EXISTS watches;
+DROP TABLE IF EXISTS page_versions;
+DROP TABLE IF EXISTS crawl_workers;
+DROP TABLE IF EXISTS frontier;
+DROP TABLE IF EXISTS crawl_domains;
+DROP TABLE IF EXISTS crawl_runs;
+DROP TABLE IF EXISTS symbols;
+DROP TABLE IF EXISTS pages_fts;
+DROP TABLE IF EXISTS sections;
+DROP TABLE IF EXISTS pages;
+DROP TABLE IF EXISTS sources;
@@ -0,0 +1,175 @@
+-- The sqlite schema mirrors the postgres one. Times are unix milliseconds,
+-- arrays and objects are json text.
+
+CREATE TABLE sources (
+    id INTEGER PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL,
+    domains TEXT NOT NULL,
+    seeds TEXT NOT NULL,
+    settings TEXT NOT NULL DEFAULT '{}',
+    owner TEXT,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+INSERT INTO sources (name, domains, seeds, settings, created_at, updated_at)
+VALUES (
+    'pytorch',
+    '["pytorch.org", "docs.pytorch.org"]',
+    '["https://pytorch.org/docs/stable/index.html"]',
+    '{"delay_ms": 1000, "parallelism": 4, "inventories": ["https://pytorch.org/docs/stable/objects.inv"]}',
+    CAST(strftime('%s', 'now') AS INTEGER) * 1000,
+    CAST(strftime('%s', 'now') AS INTEGER) * 1000
+);
+
+CREATE TABLE pages (
+    id INTEGER PRIMARY KEY,
+    url TEXT UNIQUE NOT NULL,
+    title TEXT,
+    crawled_at INTEGER,
+    source TEXT,
+    tags TEXT,
+    votes INTEGER,
+    description TEXT,
+    opengraph TEXT,
+    breadcrumbs TEXT,
+    last_updated TEXT,
+    deprecated TEXT,
+    quality REAL,
+    private INTEGER NOT NULL DEFAULT 0,
+    source_id INTEGER REFERENCES sources(id) ON DELETE SET NULL
+);
+
+CREATE INDEX pages_source_idx ON pages (source);
+CREATE INDEX pages_source_id_idx ON pages (source_id);
+CREATE INDEX pages_crawled_at_idx ON pages (crawled_at);
+
+CREATE TABLE sections (
+    id INTEGER PRIMARY KEY,
+    page_id INTEGER REFERENCES pages(id) ON DELETE CASCADE,
+    section_type TEXT,
+    content TEXT,
+    language TEXT,
+    sort_order INTEGER,
+    data TEXT
+);
+
+CREATE INDEX sections_page_idx ON sections (page_id, sort_order);
+
+-- full-text index of pages, the rowid is the page id
+CREATE VIRTUAL TABLE pages_fts USING fts5(title, description, code, body, tokenize = 'porter unicode61');
+
+CREATE TABLE symbols (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    domain TEXT NOT NULL,
+    role TEXT NOT NULL,
+    url TEXT NOT NULL,
+    display_name TEXT,
+    project TEXT,
+    version TEXT,
+    priority INTEGER,
+    UNIQUE (name, domain, role, url)
+);
+
+CREATE INDEX symbols_name_idx ON symbols (lower(name));
+CREATE INDEX symbols_page_idx ON symbols (CASE WHEN instr(url, '#') > 0 THEN substr(url, 1, instr(url, '#') - 1) ELSE url END);
+
+CREATE TABLE crawl_runs (
+    id INTEGER PRIMARY KEY,
+    source TEXT NOT NULL,
+    started_at INTEGER NOT NULL,
+    finished_at INTEGER NOT NULL,
+    fetched INTEGER NOT NULL DEFAULT 0,
+    saved INTEGER NOT NULL DEFAULT 0,
+    skipped INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    bytes INTEGER NOT NULL DEFAULT 0,
+    statuses TEXT,
+    errors TEXT,
+    slow_urls TEXT
+);
+
+CREATE INDEX crawl_runs_started_idx ON crawl_runs (source, started_at DESC);
+
+CREATE TABLE crawl_domains (
+    domain TEXT PRIMARY KEY,
+    delay_ms INTEGER NOT NULL DEFAULT 1000,
+    next_fetch_at INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE frontier (
+    id INTEGER PRIMARY KEY,
+    url TEXT UNIQUE NOT NULL,
+    domain TEXT NOT NULL REFERENCES crawl_domains(domain),
+    depth INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    priority INTEGER NOT NULL DEFAULT 0,
+    lease_owner TEXT,
+    lease_expires INTEGER,
+    last_error TEXT,
+    added_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+CREATE INDEX frontier_priority_idx ON frontier (status, priority DESC, depth, id);
+CREATE INDEX frontier_lease_idx ON frontier (lease_owner) WHERE status = 'leased';
+
+CREATE TABLE crawl_workers (
+    id TEXT PRIMARY KEY,
+    host TEXT,
+    started_at INTEGER NOT NULL,
+    heartbeat_at INTEGER NOT NULL,
+    stopped_at INTEGER,
+    current_url TEXT,
+    fetched INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE page_versions (
+    id INTEGER PRIMARY KEY,
+    page_id INTEGER NOT NULL REFERENCES pages(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    title TEXT,
+    hash TEXT NOT NULL,
+    snapshot TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    UNIQUE (page_id, version)
+);
+
+CREATE TABLE watches (
+    id INTEGER PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    target TEXT NOT NULL,
+    webhook_url TEXT,
+    secret TEXT,
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX watches_user_idx ON watches (user_id);
+CREATE INDEX watches_target_idx ON watches (kind, target);
+
+CREATE TABLE watch_events (
+    id INTEGER PRIMARY KEY,
+    watch_id INTEGER NOT NULL REFERENCES watches(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    title TEXT,
+    version INTEGER NOT NULL,
+    message TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at INTEGER NOT NULL,
+    delivered_at INTEGER,
+    last_error TEXT
+);
+
+CREATE INDEX watch_events_watch_idx ON watch_events (watch_id, id);
+CREATE INDEX watch_events_pending_idx ON watch_events (next_attempt_at) WHERE delivered_at IS NULL;
+
+CREATE TABLE sync_checkpoints (
+    name TEXT PRIMARY KEY,
+    synced_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
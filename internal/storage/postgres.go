@@ -2,17 +2,24 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"oss/internal/models"
+	"strings"
 	"time"
 
 	// Import your crawler types
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type DB struct {
 	Pool *pgxpool.Pool
+	// KeepVersions caps the snapshots kept per page, DefaultKeepVersions
+	// when zero
+	KeepVersions int
 }
 
 func NewDB(connString string) (*DB, error) {
@@ -23,6 +30,18 @@ func NewDB(connString string) (*DB, error) {
 	return &DB{Pool: pool}, nil
 }
 
+func (db *DB) Dialect() string {
+	return "postgres"
+}
+
+func (db *DB) Ping(ctx context.Context) error {
+	return db.Pool.Ping(ctx)
+}
+
+func (db *DB) SetKeepVersions(n int) {
+	db.KeepVersions = n
+}
+
 func (db *DB) SavePage(ctx context.Context, p models.ScrapedPage) error {
 	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
@@ -30,15 +49,9 @@ func (db *DB) SavePage(ctx context.Context, p models.ScrapedPage) error {
 	}
 	defer tx.Rollback(ctx)
 
-	queryPage := `
-		INSERT INTO pages (url, title, crawled_at)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (url)
-		DO UPDATE SET title = EXCLUDED.title, crawled_at = EXCLUDED.crawled_AT
-		RETURNING id;
-		`
 	var pageID int
-	err = tx.QueryRow(ctx, queryPage, p.URL, p.Title, time.Now()).Scan(&pageID)
+	var inserted bool
+	err = tx.QueryRow(ctx, upsertPageQuery, upsertPageArgs(p, time.Now())...).Scan(&pageID, &inserted)
 	if err != nil {
 		return fmt.Errorf("failed to save page: %v", err)
 	}
@@ -49,84 +62,321 @@ func (db *DB) SavePage(ctx context.Context, p models.ScrapedPage) error {
 	}
 
 	querySection := `
-		INSERT INTO sections (page_id, section_type, content, language, sort_order)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO sections (page_id, section_type, content, language, sort_order, data)
+		VALUES ($1, $2, $3, $4, $5, $6)
 	`
 
 	for i, section := range p.Sections {
+		data, err := sectionData(section)
+		if err != nil {
+			return fmt.Errorf("failed to encode section %v: %v", i, err)
+		}
 		_, err = tx.Exec(ctx, querySection,
 			pageID,
 			section.Type,
 			section.Content,
 			section.Language,
-			i)
+			i,
+			data)
 		if err != nil {
-			fmt.Errorf("failed to save section %v with error %v", i, err)
+			return fmt.Errorf("failed to save section %v with error %v", i, err)
+		}
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE pages SET search_vector = page_search_vector(id) WHERE id = $1`, pageID)
+	if err != nil {
+		return fmt.Errorf("failed to index page text: %v", err)
+	}
+
+	version, err := db.saveVersion(ctx, tx, pageID, p)
+	if err != nil {
+		return fmt.Errorf("failed to save page version: %v", err)
+	}
+	if version > 0 && (version > 1 || inserted) {
+		watches := &pgx.Batch{}
+		queueWatchEvents(watches, p, version)
+		if err := tx.SendBatch(ctx, watches).Close(); err != nil {
+			return fmt.Errorf("failed to match watches: %v", err)
 		}
 	}
 	return tx.Commit(ctx)
 }
 
-func (db *DB) Close() {
-	db.Pool.Close()
+// upsertPageQuery inserts or updates a page row and returns its id and
+// whether it was inserted, with the parameters of upsertPageArgs. xmax is 0
+// only on a row the statement inserted.
+const upsertPageQuery = `
+	INSERT INTO pages (url, title, crawled_at, source, tags, votes,
+		description, opengraph, breadcrumbs, last_updated, deprecated, quality, private, source_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13,
+		COALESCE($14, (SELECT id FROM sources WHERE $15 = ANY (domains) ORDER BY id LIMIT 1)))
+	ON CONFLICT (url)
+	DO UPDATE SET title = EXCLUDED.title, crawled_at = EXCLUDED.crawled_AT,
+		source = EXCLUDED.source, tags = EXCLUDED.tags, votes = EXCLUDED.votes,
+		description = EXCLUDED.description, opengraph = EXCLUDED.opengraph,
+		breadcrumbs = EXCLUDED.breadcrumbs, last_updated = EXCLUDED.last_updated,
+		deprecated = EXCLUDED.deprecated, quality = EXCLUDED.quality,
+		private = EXCLUDED.private, source_id = EXCLUDED.source_id
+	RETURNING id, xmax = 0;
+	`
+
+func upsertPageArgs(p models.ScrapedPage, crawledAt time.Time) []any {
+	source := p.Source
+	if source == "" {
+		source = models.SourceWeb
+	}
+	// pages not attributed by the crawler belong to the source crawling
+	// their host, if any
+	host, _ := urlDomain(p.URL)
+	return []any{p.URL, p.Title, crawledAt, source, p.Tags, p.Votes,
+		p.Description, p.OpenGraph, p.Breadcrumbs, nullString(p.LastUpdated), p.Deprecated, p.Quality, p.Private,
+		nullInt64(p.SourceID), host}
 }
 
-func (db *DB) IteratePages(ctx context.Context, processor func(models.ScrapedPage) error) error {
-	query := `
-	 	SELECT p.url, p.title, p.crawled_at, s.content, s.section_type
-		FROM pages p
-		LEFT JOIN sections s ON p.id = s.page_id
-		ORDER BY p.id, s.sort_order; 
-	`
+// GetPage loads a page and all of its sections, nil if the url is unknown.
+func (db *DB) GetPage(ctx context.Context, url string) (*models.ScrapedPage, error) {
+	page := &models.ScrapedPage{URL: url}
+	var pageID int64
+	var crawledAt time.Time
+	err := db.Pool.QueryRow(ctx, `
+		SELECT id, COALESCE(title, ''), crawled_at, COALESCE(source, 'web'), tags, COALESCE(votes, 0),
+			`+pageMetadataColumns+`
+		FROM pages WHERE url = $1
+	`, url).Scan(&pageID, &page.Title, &crawledAt, &page.Source, &page.Tags, &page.Votes,
+		&page.Description, &page.OpenGraph, &page.Breadcrumbs, &page.LastUpdated, &page.Deprecated, &page.Quality, &page.Private, &page.SourceID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	page.CrawledAt = crawledAt.Format(time.RFC3339)
 
-	rows, err := db.Pool.Query(ctx, query)
+	sections, err := db.loadSections(ctx, []int64{pageID})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer rows.Close()
+	page.Sections = sections[pageID]
+	if page.Sections == nil {
+		page.Sections = []models.PageSection{}
+	}
+	return page, nil
+}
 
-	var currentPage *models.ScrapedPage
+// pageMetadataColumns selects description, opengraph, breadcrumbs,
+// last_updated, deprecated, quality, private and source_id in the shape
+// models.ScrapedPage holds them.
+const pageMetadataColumns = `COALESCE(description, ''), opengraph, breadcrumbs,
+	COALESCE(to_char(last_updated, 'YYYY-MM-DD'), ''), COALESCE(deprecated, ''), COALESCE(quality, 0),
+	COALESCE(private, false), COALESCE(source_id, 0)`
 
-	for rows.Next() {
-		var url, title, content, sectionType string
-		var crawledAt time.Time
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullInt64(n int64) any {
+	if n == 0 {
+		return nil
+	}
+	return n
+}
+
+// sectionData encodes the structured part of table and list sections for
+// the data column.
+func sectionData(section models.PageSection) ([]byte, error) {
+	switch {
+	case section.Table != nil:
+		return json.Marshal(section.Table)
+	case section.List != nil:
+		return json.Marshal(section.List)
+	}
+	return nil, nil
+}
 
-		err := rows.Scan(&url, &title, &crawledAt, &content, &sectionType)
+func decodeSectionData(section *models.PageSection, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	switch section.Type {
+	case "table":
+		section.Table = &models.Table{}
+		return json.Unmarshal(data, section.Table)
+	case "list":
+		section.List = &models.List{}
+		return json.Unmarshal(data, section.List)
+	}
+	return nil
+}
+
+func (db *DB) Close() {
+	db.Pool.Close()
+}
+
+// DefaultBatchSize is how many pages IteratePages loads at a time when
+// PageFilter.BatchSize isn't set.
+const DefaultBatchSize = 500
+
+// PageFilter selects the pages IteratePages visits, zero values match every
+// page.
+type PageFilter struct {
+	// UpdatedSince matches pages saved after this time
+	UpdatedSince time.Time
+	// Source matches pages of a kind, e.g. web or stackexchange
+	Source string
+	// SourceID matches pages of a registered source
+	SourceID int64
+	// MinQuality matches pages scoring at least this, unscored pages count
+	// as 0.5 like they do in ranking
+	MinQuality float64
+	// PublicOnly leaves out private pages
+	PublicOnly bool
+	URLPrefix  string
+	IDs        []int64
+	BatchSize  int
+}
+
+// where renders the filter as sql conditions on pages, numbering its
+// parameters after args.
+func (f PageFilter) where(args []any) (string, []any) {
+	var conds []string
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if !f.UpdatedSince.IsZero() {
+		add("crawled_at > $%d", f.UpdatedSince)
+	}
+	if f.Source != "" {
+		add("COALESCE(source, 'web') = $%d", f.Source)
+	}
+	if f.SourceID != 0 {
+		add("source_id = $%d", f.SourceID)
+	}
+	if f.MinQuality > 0 {
+		add("COALESCE(quality, 0.5) >= $%d", f.MinQuality)
+	}
+	if f.PublicOnly {
+		conds = append(conds, "NOT COALESCE(private, false)")
+	}
+	if f.URLPrefix != "" {
+		add("starts_with(url, $%d)", f.URLPrefix)
+	}
+	if len(f.IDs) > 0 {
+		add("id = ANY($%d)", f.IDs)
+	}
+	if len(conds) == 0 {
+		return "true", args
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// IteratePages calls processor with every page matching filter, in id
+// order, with all of their sections. Pages are read in batches, each
+// starting after the last id of the one before, so memory stays bounded
+// however large the corpus is.
+func (db *DB) IteratePages(ctx context.Context, filter PageFilter, processor func(models.ScrapedPage) error) error {
+	size := filter.BatchSize
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	var after int64
+	for {
+		ids, pages, err := db.pageBatch(ctx, filter, after, size)
 		if err != nil {
 			return err
 		}
-
-		if currentPage != nil && currentPage.URL != url {
-			err = processor(*currentPage)
-			if err != nil {
+		for _, p := range pages {
+			if err := processor(p); err != nil {
 				return err
 			}
-			currentPage = nil
 		}
-
-		if currentPage == nil {
-			currentPage = &models.ScrapedPage{
-				URL:       url,
-				Title:     title,
-				CrawledAt: crawledAt.Format(time.RFC3339),
-				Sections:  []models.PageSection{},
-			}
+		if len(pages) < size {
+			return nil
 		}
+		after = ids[len(ids)-1]
+	}
+}
 
-		if content != "" {
-			currentPage.Sections = append(currentPage.Sections, models.PageSection{
-				Type:    sectionType,
-				Content: content,
-			})
-		}
+// pageBatch loads up to limit pages matching filter with ids above after,
+// and their sections.
+func (db *DB) pageBatch(ctx context.Context, filter PageFilter, after int64, limit int) ([]int64, []models.ScrapedPage, error) {
+	where, args := filter.where([]any{after, limit})
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, url, COALESCE(title, ''), crawled_at, COALESCE(source, 'web'), tags, COALESCE(votes, 0),
+			`+pageMetadataColumns+`
+		FROM pages
+		WHERE id > $1 AND `+where+`
+		ORDER BY id
+		LIMIT $2
+	`, args...)
+	if err != nil {
+		return nil, nil, err
 	}
+	defer rows.Close()
 
-	if currentPage != nil {
-		err := processor(*currentPage)
+	var ids []int64
+	var pages []models.ScrapedPage
+	for rows.Next() {
+		var id int64
+		var page models.ScrapedPage
+		var crawledAt time.Time
+		err := rows.Scan(&id, &page.URL, &page.Title, &crawledAt, &page.Source, &page.Tags, &page.Votes,
+			&page.Description, &page.OpenGraph, &page.Breadcrumbs, &page.LastUpdated, &page.Deprecated, &page.Quality, &page.Private, &page.SourceID)
 		if err != nil {
-			return err
+			return nil, nil, err
+		}
+		page.CrawledAt = crawledAt.Format(time.RFC3339)
+		ids = append(ids, id)
+		pages = append(pages, page)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+
+	sections, err := db.loadSections(ctx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, id := range ids {
+		pages[i].Sections = sections[id]
+		if pages[i].Sections == nil {
+			pages[i].Sections = []models.PageSection{}
 		}
 	}
-	return rows.Err()
+	return ids, pages, nil
+}
 
+// loadSections returns the sections of the given pages, in order, keyed by
+// page id.
+func (db *DB) loadSections(ctx context.Context, pageIDs []int64) (map[int64][]models.PageSection, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT page_id, COALESCE(section_type, ''), COALESCE(content, ''), COALESCE(language, ''), data
+		FROM sections WHERE page_id = ANY($1)
+		ORDER BY page_id, sort_order
+	`, pageIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sections := map[int64][]models.PageSection{}
+	for rows.Next() {
+		var pageID int64
+		var section models.PageSection
+		var data []byte
+		if err := rows.Scan(&pageID, &section.Type, &section.Content, &section.Language, &data); err != nil {
+			return nil, err
+		}
+		if err := decodeSectionData(&section, data); err != nil {
+			return nil, err
+		}
+		sections[pageID] = append(sections[pageID], section)
+	}
+	return sections, rows.Err()
 }
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"oss/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SaveCrawlRun stores a crawl report and sets its id.
+func (db *DB) SaveCrawlRun(ctx context.Context, run *models.CrawlRun) error {
+	query := `
+		INSERT INTO crawl_runs (source, started_at, finished_at, fetched, saved, skipped, failed,
+			bytes, statuses, errors, slow_urls)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id
+	`
+	return db.Pool.QueryRow(ctx, query,
+		run.Source,
+		run.StartedAt,
+		run.FinishedAt,
+		run.Fetched,
+		run.Saved,
+		run.Skipped,
+		run.Failed,
+		run.Bytes,
+		run.Statuses,
+		run.Errors,
+		run.SlowURLs).Scan(&run.ID)
+}
+
+const crawlRunColumns = `id, source, started_at, finished_at, fetched, saved, skipped, failed,
+	bytes, statuses, errors, slow_urls`
+
+func scanCrawlRun(row pgx.Row) (*models.CrawlRun, error) {
+	run := &models.CrawlRun{}
+	err := row.Scan(&run.ID, &run.Source, &run.StartedAt, &run.FinishedAt,
+		&run.Fetched, &run.Saved, &run.Skipped, &run.Failed, &run.Bytes,
+		&run.Statuses, &run.Errors, &run.SlowURLs)
+	return run, err
+}
+
+// ListCrawlRuns returns the latest runs first, optionally only those of one
+// source.
+func (db *DB) ListCrawlRuns(ctx context.Context, source string, limit int) ([]models.CrawlRun, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+crawlRunColumns+`
+		FROM crawl_runs
+		WHERE $1 = '' OR source = $1
+		ORDER BY started_at DESC
+		LIMIT $2
+	`, source, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []models.CrawlRun{}
+	for rows.Next() {
+		run, err := scanCrawlRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+// GetCrawlRun loads one run, nil if the id is unknown.
+func (db *DB) GetCrawlRun(ctx context.Context, id int64) (*models.CrawlRun, error) {
+	run, err := scanCrawlRun(db.Pool.QueryRow(ctx, `
+		SELECT `+crawlRunColumns+`
+		FROM crawl_runs WHERE id = $1
+	`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return run, err
+}
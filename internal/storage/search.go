@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"oss/internal/models"
+)
+
+// SearchPages finds the pages matching a web search style query with
+// postgres full-text search, best first. Ranking mirrors the elasticsearch
+// query: ts_rank scaled by log10(2 + quality), deprecated pages demoted.
+// Each page has a single section, a snippet of its text around the matches.
+func (db *DB) SearchPages(ctx context.Context, query string, filter PageFilter, limit int) ([]models.ScrapedPage, error) {
+	where, args := filter.where([]any{query, limit})
+	rows, err := db.Pool.Query(ctx, `
+		WITH q AS (SELECT websearch_to_tsquery('english', $1) AS tsq),
+		hits AS (
+			SELECT id, ts_rank(search_vector, q.tsq) * log(2 + COALESCE(quality, 0.5))
+				* CASE WHEN COALESCE(deprecated, '') = '' THEN 1 ELSE 0.3 END AS rank
+			FROM pages, q
+			WHERE search_vector @@ q.tsq AND `+where+`
+			ORDER BY rank DESC
+			LIMIT $2
+		)
+		SELECT p.url, COALESCE(p.title, ''), p.crawled_at, COALESCE(p.source, 'web'), p.tags, COALESCE(p.votes, 0),
+			`+pageMetadataColumns+`,
+			ts_headline('english', COALESCE((
+				SELECT left(string_agg(content, ' ' ORDER BY sort_order), 65536) FROM sections
+				WHERE page_id = p.id AND COALESCE(section_type, '') <> 'code'
+			), ''), q.tsq,
+				'StartSel="", StopSel="", MinWords=15, MaxWords=35, MaxFragments=2')
+		FROM hits JOIN pages p ON p.id = hits.id, q
+		ORDER BY hits.rank DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pages []models.ScrapedPage
+	for rows.Next() {
+		var page models.ScrapedPage
+		var crawledAt time.Time
+		var snippet string
+		err := rows.Scan(&page.URL, &page.Title, &crawledAt, &page.Source, &page.Tags, &page.Votes,
+			&page.Description, &page.OpenGraph, &page.Breadcrumbs, &page.LastUpdated, &page.Deprecated, &page.Quality, &page.Private, &page.SourceID,
+			&snippet)
+		if err != nil {
+			return nil, err
+		}
+		page.CrawledAt = crawledAt.Format(time.RFC3339)
+		page.Sections = []models.PageSection{{Content: snippet}}
+		pages = append(pages, page)
+	}
+	return pages, rows.Err()
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"oss/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrSourceExists is returned when a source name is already registered.
+var ErrSourceExists = errors.New("a source with this name already exists")
+
+const sourceColumns = `id, name, domains, seeds, settings, COALESCE(owner, ''), enabled, created_at, updated_at`
+
+func scanSource(row pgx.Row) (*models.Source, error) {
+	var s models.Source
+	err := row.Scan(&s.ID, &s.Name, &s.Domains, &s.Seeds, &s.Settings, &s.Owner, &s.Enabled, &s.CreatedAt, &s.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// uniqueViolation maps a duplicate name to ErrSourceExists.
+func uniqueViolation(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrSourceExists
+	}
+	return err
+}
+
+// CreateSource registers a source and sets its id and timestamps.
+func (db *DB) CreateSource(ctx context.Context, s *models.Source) error {
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO sources (name, domains, seeds, settings, owner, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at
+	`, s.Name, s.Domains, s.Seeds, s.Settings, nullString(s.Owner), s.Enabled).Scan(&s.ID, &s.CreatedAt, &s.UpdatedAt)
+	return uniqueViolation(err)
+}
+
+// UpdateSource replaces a source's name, domains, seeds, settings and
+// enabled flag. Only the owner can change an owned source, an unowned one
+// is claimed by whoever updates it. It returns nil if there is no such
+// source the owner may change.
+func (db *DB) UpdateSource(ctx context.Context, s *models.Source) (*models.Source, error) {
+	row := db.Pool.QueryRow(ctx, `
+		UPDATE sources SET name = $2, domains = $3, seeds = $4, settings = $5, enabled = $6,
+			owner = COALESCE(owner, $7), updated_at = now()
+		WHERE id = $1 AND (owner IS NULL OR owner = $7)
+		RETURNING `+sourceColumns, s.ID, s.Name, s.Domains, s.Seeds, s.Settings, s.Enabled, nullString(s.Owner))
+	updated, err := scanSource(row)
+	return updated, uniqueViolation(err)
+}
+
+// SetSourceEnabled enables or disables a source, with the same ownership
+// rule as UpdateSource. It returns false if the owner can't change it.
+func (db *DB) SetSourceEnabled(ctx context.Context, id int64, owner string, enabled bool) (bool, error) {
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE sources SET enabled = $3, updated_at = now()
+		WHERE id = $1 AND (owner IS NULL OR owner = $2)
+	`, id, owner, enabled)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetSource returns a source by id, nil if there is none.
+func (db *DB) GetSource(ctx context.Context, id int64) (*models.Source, error) {
+	return scanSource(db.Pool.QueryRow(ctx, `SELECT `+sourceColumns+` FROM sources WHERE id = $1`, id))
+}
+
+// GetSourceByName returns a source by name, nil if there is none.
+func (db *DB) GetSourceByName(ctx context.Context, name string) (*models.Source, error) {
+	return scanSource(db.Pool.QueryRow(ctx, `SELECT `+sourceColumns+` FROM sources WHERE name = $1`, name))
+}
+
+// ListSources returns the registered sources by name, only the enabled ones
+// if enabledOnly is set.
+func (db *DB) ListSources(ctx context.Context, enabledOnly bool) ([]models.Source, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+sourceColumns+` FROM sources
+		WHERE enabled OR NOT $1
+		ORDER BY name
+	`, enabledOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sources := []models.Source{}
+	for rows.Next() {
+		s, err := scanSource(rows)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, *s)
+	}
+	return sources, rows.Err()
+}
@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLite is the storage API on a local SQLite file, for a single machine
+// without a database server. It has one connection, so writes from
+// concurrent goroutines queue up rather than fail; other processes sharing
+// the file wait up to the busy timeout for their turn.
+type SQLite struct {
+	db *sql.DB
+	// KeepVersions caps the snapshots kept per page, DefaultKeepVersions
+	// when zero
+	KeepVersions int
+}
+
+// NewSQLite opens, or creates, the SQLite database at path.
+func NewSQLite(path string) (*SQLite, error) {
+	dsn := path + "?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	return &SQLite{db: db}, nil
+}
+
+func (s *SQLite) Dialect() string {
+	return "sqlite"
+}
+
+func (s *SQLite) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *SQLite) Close() {
+	s.db.Close()
+}
+
+func (s *SQLite) SetKeepVersions(n int) {
+	s.KeepVersions = n
+}
+
+// Times are stored as unix milliseconds, so they compare as numbers.
+func millis(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.UnixMilli(ms)
+}
+
+func nullMillis(ms sql.NullInt64) *time.Time {
+	if !ms.Valid {
+		return nil
+	}
+	t := fromMillis(ms.Int64)
+	return &t
+}
+
+// jsonText encodes arrays and objects for json text columns, NULL for nil.
+func jsonText(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if string(data) == "null" {
+		return nil, nil
+	}
+	return string(data), nil
+}
+
+// jsonColumn scans a json text column into dst, leaving it alone for NULL.
+type jsonColumn struct {
+	dst any
+}
+
+func (c jsonColumn) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), c.dst)
+	case []byte:
+		return json.Unmarshal(v, c.dst)
+	}
+	return fmt.Errorf("can't scan %T as json", src)
+}
+
+// placeholders returns n comma separated ? for an IN list.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// sqliteUnique maps a duplicate source name to ErrSourceExists.
+func sqliteUnique(err error) error {
+	var e *sqlite.Error
+	if errors.As(err, &e) && e.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return ErrSourceExists
+	}
+	return err
+}
+
+func (s *SQLite) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT count(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'
+	`).Scan(&exists)
+	if err != nil || !exists {
+		return map[int]time.Time{}, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at int64
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = fromMillis(at)
+	}
+	return applied, rows.Err()
+}
+
+func (s *SQLite) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := readMigrations("migrations/sqlite")
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return migrationStatus(migrations, applied), nil
+}
+
+// CheckSchema fails unless the file has exactly the sqlite migrations of
+// this build, see DB.CheckSchema.
+func (s *SQLite) CheckSchema(ctx context.Context) error {
+	migrations, err := readMigrations("migrations/sqlite")
+	if err != nil {
+		return err
+	}
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %v", err)
+	}
+	return checkSchema(migrations, applied)
+}
+
+// Migrate applies pending sqlite migrations up to and including target, or
+// all of them when target is 0, each in its own transaction.
+func (s *SQLite) Migrate(ctx context.Context, target int) ([]Migration, error) {
+	migrations, err := readMigrations("migrations/sqlite")
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.prepareMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, m := range migrations {
+		if target > 0 && m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := s.runMigration(ctx, m.Up,
+			`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`, m.Version, m.Name, millis(time.Now()))
+		if err != nil {
+			return done, fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// Rollback reverts the latest steps applied sqlite migrations, newest
+// first.
+func (s *SQLite) Rollback(ctx context.Context, steps int) ([]Migration, error) {
+	migrations, err := readMigrations("migrations/sqlite")
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.prepareMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		err := s.runMigration(ctx, m.Down, `DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+		if err != nil {
+			return done, fmt.Errorf("rollback of %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+func (s *SQLite) prepareMigrations(ctx context.Context) (map[int]time.Time, error) {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at INTEGER NOT NULL
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return s.appliedMigrations(ctx)
+}
+
+// runMigration runs a migration script and its bookkeeping in one
+// transaction. Transactions take the write lock up front, so a second
+// migrate run waits rather than applying the same migration.
+func (s *SQLite) runMigration(ctx context.Context, script, record string, args ...any) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLite) Checkpoint(ctx context.Context, name string) (time.Time, error) {
+	var at int64
+	err := s.db.QueryRowContext(ctx, `SELECT synced_at FROM sync_checkpoints WHERE name = ?`, name).Scan(&at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fromMillis(at), nil
+}
+
+func (s *SQLite) SaveCheckpoint(ctx context.Context, name string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO sync_checkpoints (name, synced_at, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET synced_at = excluded.synced_at, updated_at = excluded.updated_at
+	`, name, millis(at), millis(time.Now()))
+	return err
+}
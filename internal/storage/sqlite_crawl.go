@@ -0,0 +1,587 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"oss/internal/models"
+)
+
+// SaveSymbols upserts a batch of symbols in one transaction.
+func (s *SQLite) SaveSymbols(ctx context.Context, symbols []models.Symbol) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, sym := range symbols {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO symbols (name, domain, role, url, display_name, project, version, priority)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (name, domain, role, url)
+			DO UPDATE SET display_name = excluded.display_name, project = excluded.project,
+				version = excluded.version, priority = excluded.priority
+		`, sym.Name, sym.Domain, sym.Role, sym.URL, sym.DisplayName, sym.Project, sym.Version, sym.Priority)
+		if err != nil {
+			return fmt.Errorf("failed to save symbol %s: %v", sym.Name, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// LookupSymbols finds symbols named name, or whose dotted path ends in
+// name, exact matches first.
+func (s *SQLite) LookupSymbols(ctx context.Context, name string, limit int) ([]models.Symbol, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT name, domain, role, url, COALESCE(display_name, ''), COALESCE(project, ''),
+			COALESCE(version, ''), COALESCE(priority, 1)
+		FROM symbols
+		WHERE lower(name) = lower(?1) OR lower(name) LIKE '%.' || lower(?2) ESCAPE '\'
+		ORDER BY lower(name) = lower(?1) DESC, priority, length(name), name
+		LIMIT ?3
+	`, name, escapeLike(name), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	symbols := []models.Symbol{}
+	for rows.Next() {
+		var sym models.Symbol
+		err := rows.Scan(&sym.Name, &sym.Domain, &sym.Role, &sym.URL, &sym.DisplayName, &sym.Project, &sym.Version, &sym.Priority)
+		if err != nil {
+			return nil, err
+		}
+		symbols = append(symbols, sym)
+	}
+	return symbols, rows.Err()
+}
+
+const sqliteSourceColumns = `id, name, domains, seeds, settings, COALESCE(owner, ''), enabled, created_at, updated_at`
+
+func scanSQLiteSource(row rowScanner) (*models.Source, error) {
+	var src models.Source
+	var createdAt, updatedAt int64
+	err := row.Scan(&src.ID, &src.Name, jsonColumn{&src.Domains}, jsonColumn{&src.Seeds}, jsonColumn{&src.Settings},
+		&src.Owner, &src.Enabled, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	src.CreatedAt = fromMillis(createdAt)
+	src.UpdatedAt = fromMillis(updatedAt)
+	return &src, nil
+}
+
+// sourceJSON encodes the json columns of a source.
+func sourceJSON(src *models.Source) (domains, seeds, settings any, err error) {
+	if domains, err = jsonText(src.Domains); err != nil {
+		return
+	}
+	if seeds, err = jsonText(src.Seeds); err != nil {
+		return
+	}
+	settings, err = jsonText(src.Settings)
+	return
+}
+
+// CreateSource registers a source and sets its id and timestamps.
+func (s *SQLite) CreateSource(ctx context.Context, src *models.Source) error {
+	domains, seeds, settings, err := sourceJSON(src)
+	if err != nil {
+		return err
+	}
+	now := millis(time.Now())
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO sources (name, domains, seeds, settings, owner, enabled, created_at, updated_at)
+		VALUES (?, COALESCE(?, '[]'), COALESCE(?, '[]'), ?, ?, ?, ?, ?)
+		RETURNING id
+	`, src.Name, domains, seeds, settings, nullString(src.Owner), src.Enabled, now, now).Scan(&src.ID)
+	if err != nil {
+		return sqliteUnique(err)
+	}
+	src.CreatedAt = fromMillis(now)
+	src.UpdatedAt = src.CreatedAt
+	return nil
+}
+
+// UpdateSource replaces a source's name, domains, seeds, settings and
+// enabled flag, with the ownership rule of DB.UpdateSource.
+func (s *SQLite) UpdateSource(ctx context.Context, src *models.Source) (*models.Source, error) {
+	domains, seeds, settings, err := sourceJSON(src)
+	if err != nil {
+		return nil, err
+	}
+	row := s.db.QueryRowContext(ctx, `
+		UPDATE sources SET name = ?2, domains = COALESCE(?3, '[]'), seeds = COALESCE(?4, '[]'), settings = ?5,
+			enabled = ?6, owner = COALESCE(owner, ?7), updated_at = ?8
+		WHERE id = ?1 AND (owner IS NULL OR owner = ?7)
+		RETURNING `+sqliteSourceColumns,
+		src.ID, src.Name, domains, seeds, settings, src.Enabled, nullString(src.Owner), millis(time.Now()))
+	updated, err := scanSQLiteSource(row)
+	return updated, sqliteUnique(err)
+}
+
+// SetSourceEnabled enables or disables a source, with the same ownership
+// rule as UpdateSource. It returns false if the owner can't change it.
+func (s *SQLite) SetSourceEnabled(ctx context.Context, id int64, owner string, enabled bool) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE sources SET enabled = ?, updated_at = ?
+		WHERE id = ? AND (owner IS NULL OR owner = ?)
+	`, enabled, millis(time.Now()), id, owner)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// GetSource returns a source by id, nil if there is none.
+func (s *SQLite) GetSource(ctx context.Context, id int64) (*models.Source, error) {
+	return scanSQLiteSource(s.db.QueryRowContext(ctx, `SELECT `+sqliteSourceColumns+` FROM sources WHERE id = ?`, id))
+}
+
+// GetSourceByName returns a source by name, nil if there is none.
+func (s *SQLite) GetSourceByName(ctx context.Context, name string) (*models.Source, error) {
+	return scanSQLiteSource(s.db.QueryRowContext(ctx, `SELECT `+sqliteSourceColumns+` FROM sources WHERE name = ?`, name))
+}
+
+// ListSources returns the registered sources by name, only the enabled ones
+// if enabledOnly is set.
+func (s *SQLite) ListSources(ctx context.Context, enabledOnly bool) ([]models.Source, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+sqliteSourceColumns+` FROM sources
+		WHERE enabled OR NOT ?
+		ORDER BY name
+	`, enabledOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sources := []models.Source{}
+	for rows.Next() {
+		src, err := scanSQLiteSource(rows)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, *src)
+	}
+	return sources, rows.Err()
+}
+
+// SaveCrawlRun stores a crawl report and sets its id.
+func (s *SQLite) SaveCrawlRun(ctx context.Context, run *models.CrawlRun) error {
+	statuses, err := jsonText(run.Statuses)
+	if err != nil {
+		return err
+	}
+	errs, err := jsonText(run.Errors)
+	if err != nil {
+		return err
+	}
+	slow, err := jsonText(run.SlowURLs)
+	if err != nil {
+		return err
+	}
+	return s.db.QueryRowContext(ctx, `
+		INSERT INTO crawl_runs (source, started_at, finished_at, fetched, saved, skipped, failed,
+			bytes, statuses, errors, slow_urls)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, run.Source, millis(run.StartedAt), millis(run.FinishedAt), run.Fetched, run.Saved, run.Skipped, run.Failed,
+		run.Bytes, statuses, errs, slow).Scan(&run.ID)
+}
+
+func scanSQLiteCrawlRun(row rowScanner) (*models.CrawlRun, error) {
+	run := &models.CrawlRun{}
+	var startedAt, finishedAt int64
+	err := row.Scan(&run.ID, &run.Source, &startedAt, &finishedAt,
+		&run.Fetched, &run.Saved, &run.Skipped, &run.Failed, &run.Bytes,
+		jsonColumn{&run.Statuses}, jsonColumn{&run.Errors}, jsonColumn{&run.SlowURLs})
+	run.StartedAt = fromMillis(startedAt)
+	run.FinishedAt = fromMillis(finishedAt)
+	return run, err
+}
+
+// ListCrawlRuns returns the latest runs first, optionally only those of one
+// source.
+func (s *SQLite) ListCrawlRuns(ctx context.Context, source string, limit int) ([]models.CrawlRun, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+crawlRunColumns+`
+		FROM crawl_runs
+		WHERE ?1 = '' OR source = ?1
+		ORDER BY started_at DESC
+		LIMIT ?2
+	`, source, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []models.CrawlRun{}
+	for rows.Next() {
+		run, err := scanSQLiteCrawlRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+// GetCrawlRun loads one run, nil if the id is unknown.
+func (s *SQLite) GetCrawlRun(ctx context.Context, id int64) (*models.CrawlRun, error) {
+	run, err := scanSQLiteCrawlRun(s.db.QueryRowContext(ctx, `
+		SELECT `+crawlRunColumns+`
+		FROM crawl_runs WHERE id = ?
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return run, err
+}
+
+// SeedFrontier allows crawling domains and queues the start urls, see
+// DB.SeedFrontier.
+func (s *SQLite) SeedFrontier(ctx context.Context, domains, urls []string, delay time.Duration, recrawl bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := millis(time.Now())
+	for _, d := range domains {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO crawl_domains (domain, delay_ms) VALUES (?, ?)
+			ON CONFLICT (domain) DO UPDATE SET delay_ms = excluded.delay_ms
+		`, strings.ToLower(d), delay.Milliseconds())
+		if err != nil {
+			return fmt.Errorf("failed to save domain %s: %v", d, err)
+		}
+	}
+	for _, u := range urls {
+		domain, err := urlDomain(u)
+		if err != nil {
+			return err
+		}
+		// a start url's own domain is always allowed
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO crawl_domains (domain, delay_ms) VALUES (?, ?)
+			ON CONFLICT (domain) DO NOTHING
+		`, domain, delay.Milliseconds())
+		if err != nil {
+			return fmt.Errorf("failed to save domain %s: %v", domain, err)
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO frontier (url, domain, depth, added_at, updated_at) VALUES (?1, ?2, 0, ?3, ?3)
+			ON CONFLICT (url) DO UPDATE SET status = 'pending', attempts = 0, depth = 0, updated_at = ?3
+			WHERE frontier.status <> 'leased'
+		`, u, domain, now)
+		if err != nil {
+			return fmt.Errorf("failed to queue %s: %v", u, err)
+		}
+	}
+	if recrawl {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE frontier SET status = 'pending', attempts = 0, updated_at = ?
+			WHERE status IN ('done', 'failed')
+		`, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Enqueue adds discovered urls. Urls already in the frontier and urls on
+// domains that weren't seeded are ignored.
+func (s *SQLite) Enqueue(ctx context.Context, urls []string, depth int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := millis(time.Now())
+	for _, u := range urls {
+		domain, err := urlDomain(u)
+		if err != nil {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO frontier (url, domain, depth, added_at, updated_at)
+			SELECT ?1, domain, ?3, ?4, ?4 FROM crawl_domains WHERE domain = ?2
+			ON CONFLICT (url) DO NOTHING
+		`, u, domain, depth, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RequestRecrawl queues urls ahead of the normal crawl order and returns the
+// ones queued, see DB.RequestRecrawl.
+func (s *SQLite) RequestRecrawl(ctx context.Context, urls []string, priority int) ([]string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := millis(time.Now())
+	var queued []string
+	for _, u := range urls {
+		domain, err := urlDomain(u)
+		if err != nil {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, sqliteAllowSourceDomainQuery, domain); err != nil {
+			return nil, err
+		}
+		var url string
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO frontier (url, domain, depth, priority, added_at, updated_at)
+			SELECT ?1, domain, 0, ?3, ?4, ?4 FROM crawl_domains WHERE domain = ?2
+			ON CONFLICT (url) DO UPDATE SET status = 'pending', attempts = 0,
+				priority = excluded.priority, updated_at = ?4
+			WHERE frontier.status <> 'leased'
+			RETURNING url
+		`, u, domain, priority, now).Scan(&url)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		queued = append(queued, url)
+	}
+	return queued, tx.Commit()
+}
+
+// sqliteAllowSourceDomainQuery lets the frontier crawl a domain an enabled
+// registered source covers, see allowSourceDomainsQuery.
+const sqliteAllowSourceDomainQuery = `
+	INSERT INTO crawl_domains (domain)
+	SELECT DISTINCT d.value FROM sources s, json_each(s.domains) d
+	WHERE s.enabled AND d.value = ?
+	ON CONFLICT (domain) DO NOTHING
+`
+
+// RequestDomainRecrawl queues every crawled url of a domain again, ahead of
+// the normal crawl order, and returns how many were queued, see
+// DB.RequestDomainRecrawl.
+func (s *SQLite) RequestDomainRecrawl(ctx context.Context, domain string, priority int) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	domain = strings.ToLower(domain)
+	now := millis(time.Now())
+	if _, err := tx.ExecContext(ctx, sqliteAllowSourceDomainQuery, domain); err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, `
+		UPDATE frontier SET status = 'pending', attempts = 0, priority = ?, updated_at = ?
+		WHERE domain = ? AND status IN ('done', 'failed')
+	`, priority, now, domain)
+	if err != nil {
+		return 0, err
+	}
+	requeued, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	res, err = tx.ExecContext(ctx, `
+		INSERT INTO frontier (url, domain, depth, priority, added_at, updated_at)
+		SELECT p.url, d.domain, 0, ?2, ?3, ?3
+		FROM pages p
+		JOIN crawl_domains d ON d.domain = ?1
+		WHERE substr(p.url, 1, length(?1) + 9) = 'https://' || ?1 || '/'
+			OR substr(p.url, 1, length(?1) + 8) = 'http://' || ?1 || '/'
+		ON CONFLICT (url) DO NOTHING
+	`, domain, priority, now)
+	if err != nil {
+		return 0, err
+	}
+	added, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(requeued + added), tx.Commit()
+}
+
+// Claim leases the next url whose domain may be fetched now, nil if there is
+// none. Transactions take the write lock when they begin, so two workers
+// can't claim the same url or domain slot.
+func (s *SQLite) Claim(ctx context.Context, worker string, lease time.Duration) (*models.FrontierURL, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := millis(time.Now())
+	next := &models.FrontierURL{}
+	err = tx.QueryRowContext(ctx, `
+		SELECT f.id, f.url, f.domain, f.depth, f.attempts
+		FROM frontier f
+		JOIN crawl_domains d ON d.domain = f.domain
+		WHERE (f.status = 'pending' OR (f.status = 'leased' AND f.lease_expires < ?1))
+			AND d.next_fetch_at <= ?1
+		ORDER BY f.priority DESC, f.depth, f.id
+		LIMIT 1
+	`, now).Scan(&next.ID, &next.URL, &next.Domain, &next.Depth, &next.Attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE frontier
+		SET status = 'leased', lease_owner = ?, lease_expires = ?, attempts = attempts + 1, updated_at = ?
+		WHERE id = ?
+	`, worker, now+lease.Milliseconds(), now, next.ID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE crawl_domains SET next_fetch_at = ? + delay_ms WHERE domain = ?
+	`, now, next.Domain)
+	if err != nil {
+		return nil, err
+	}
+	next.Attempts++
+	return next, tx.Commit()
+}
+
+// Complete marks a leased url as crawled. It is a no-op if the lease was
+// lost to another worker in the meantime.
+func (s *SQLite) Complete(ctx context.Context, id int64, worker string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE frontier
+		SET status = 'done', lease_owner = NULL, lease_expires = NULL, last_error = NULL, priority = 0,
+			updated_at = ?
+		WHERE id = ? AND lease_owner = ?
+	`, millis(time.Now()), id, worker)
+	return err
+}
+
+// Fail returns a leased url to the frontier, or gives up on it once it has
+// been tried maxAttempts times.
+func (s *SQLite) Fail(ctx context.Context, id int64, worker, reason string, maxAttempts int) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE frontier
+		SET status = CASE WHEN attempts >= ? THEN 'failed' ELSE 'pending' END,
+			lease_owner = NULL, lease_expires = NULL, last_error = ?, updated_at = ?
+		WHERE id = ? AND lease_owner = ?
+	`, maxAttempts, reason, millis(time.Now()), id, worker)
+	return err
+}
+
+// Outstanding counts the urls not yet crawled, leased ones included.
+func (s *SQLite) Outstanding(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT count(*) FROM frontier WHERE status IN ('pending', 'leased')`).Scan(&n)
+	return n, err
+}
+
+// FrontierCounts returns the number of urls in each status.
+func (s *SQLite) FrontierCounts(ctx context.Context) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT status, count(*) FROM frontier GROUP BY status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// Heartbeat records that a worker is alive and extends the leases it holds.
+func (s *SQLite) Heartbeat(ctx context.Context, w models.Worker, lease time.Duration) error {
+	now := millis(time.Now())
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO crawl_workers (id, host, started_at, heartbeat_at, current_url, fetched)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET heartbeat_at = excluded.heartbeat_at, current_url = excluded.current_url,
+			fetched = excluded.fetched, stopped_at = NULL
+	`, w.ID, w.Host, millis(w.StartedAt), now, w.CurrentURL, w.Fetched)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE frontier SET lease_expires = ?
+		WHERE lease_owner = ? AND status = 'leased'
+	`, now+lease.Milliseconds(), w.ID)
+	return err
+}
+
+// Release hands a stopping worker's leases back to the frontier and marks it
+// stopped.
+func (s *SQLite) Release(ctx context.Context, worker string) error {
+	now := millis(time.Now())
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE frontier SET status = 'pending', lease_owner = NULL, lease_expires = NULL, updated_at = ?
+		WHERE lease_owner = ? AND status = 'leased'
+	`, now, worker)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `UPDATE crawl_workers SET stopped_at = ? WHERE id = ?`, now, worker)
+	return err
+}
+
+// ListWorkers returns workers seen within the last day, a worker counts as
+// alive if it hasn't stopped and sent a heartbeat within staleAfter.
+func (s *SQLite) ListWorkers(ctx context.Context, staleAfter time.Duration) ([]models.Worker, error) {
+	now := time.Now()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, COALESCE(host, ''), started_at, heartbeat_at, stopped_at, COALESCE(current_url, ''), fetched,
+			stopped_at IS NULL AND heartbeat_at > ?
+		FROM crawl_workers
+		WHERE heartbeat_at > ?
+		ORDER BY started_at DESC
+	`, millis(now.Add(-staleAfter)), millis(now.Add(-24*time.Hour)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workers := []models.Worker{}
+	for rows.Next() {
+		var w models.Worker
+		var startedAt, heartbeatAt int64
+		var stoppedAt sql.NullInt64
+		err := rows.Scan(&w.ID, &w.Host, &startedAt, &heartbeatAt, &stoppedAt, &w.CurrentURL, &w.Fetched, &w.Alive)
+		if err != nil {
+			return nil, err
+		}
+		w.StartedAt = fromMillis(startedAt)
+		w.HeartbeatAt = fromMillis(heartbeatAt)
+		w.StoppedAt = nullMillis(stoppedAt)
+		workers = append(workers, w)
+	}
+	return workers, rows.Err()
+}
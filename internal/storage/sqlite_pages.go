@@ -0,0 +1,516 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"oss/internal/models"
+)
+
+// maxIndexText caps the code and prose indexed per page, like
+// page_search_vector does on postgres.
+const maxIndexText = 256 * 1024
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// sqlitePageColumns selects a page aliased p in the shape scanSQLitePage
+// reads.
+const sqlitePageColumns = `p.id, p.url, COALESCE(p.title, ''), p.crawled_at, COALESCE(p.source, 'web'), p.tags,
+	COALESCE(p.votes, 0), COALESCE(p.description, ''), p.opengraph, p.breadcrumbs, COALESCE(p.last_updated, ''),
+	COALESCE(p.deprecated, ''), COALESCE(p.quality, 0), p.private, COALESCE(p.source_id, 0)`
+
+func scanSQLitePage(row rowScanner, extra ...any) (int64, models.ScrapedPage, error) {
+	var id int64
+	var page models.ScrapedPage
+	var crawledAt sql.NullInt64
+	dest := append([]any{&id, &page.URL, &page.Title, &crawledAt, &page.Source, jsonColumn{&page.Tags},
+		&page.Votes, &page.Description, jsonColumn{&page.OpenGraph}, jsonColumn{&page.Breadcrumbs}, &page.LastUpdated,
+		&page.Deprecated, &page.Quality, &page.Private, &page.SourceID}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return 0, page, err
+	}
+	if crawledAt.Valid {
+		page.CrawledAt = fromMillis(crawledAt.Int64).Format(time.RFC3339)
+	}
+	return id, page, nil
+}
+
+// sqliteWhere renders the filter as sql conditions on pages aliased p, with ?
+// parameters.
+func (f PageFilter) sqliteWhere() (string, []any) {
+	var conds []string
+	var args []any
+	if !f.UpdatedSince.IsZero() {
+		conds = append(conds, "p.crawled_at > ?")
+		args = append(args, millis(f.UpdatedSince))
+	}
+	if f.Source != "" {
+		conds = append(conds, "COALESCE(p.source, 'web') = ?")
+		args = append(args, f.Source)
+	}
+	if f.SourceID != 0 {
+		conds = append(conds, "p.source_id = ?")
+		args = append(args, f.SourceID)
+	}
+	if f.MinQuality > 0 {
+		conds = append(conds, "COALESCE(p.quality, 0.5) >= ?")
+		args = append(args, f.MinQuality)
+	}
+	if f.PublicOnly {
+		conds = append(conds, "NOT COALESCE(p.private, 0)")
+	}
+	if f.URLPrefix != "" {
+		conds = append(conds, "substr(p.url, 1, ?) = ?")
+		args = append(args, utf8.RuneCountInString(f.URLPrefix), f.URLPrefix)
+	}
+	if len(f.IDs) > 0 {
+		conds = append(conds, "p.id IN ("+placeholders(len(f.IDs))+")")
+		for _, id := range f.IDs {
+			args = append(args, id)
+		}
+	}
+	if len(conds) == 0 {
+		return "1", args
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+func (s *SQLite) SavePage(ctx context.Context, p models.ScrapedPage) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.savePage(ctx, tx, p); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SavePages saves many pages in one transaction, each under a savepoint so
+// a page that fails is rolled back alone. It returns why each page failed
+// to save, nil for those saved.
+func (s *SQLite) SavePages(ctx context.Context, pages []models.ScrapedPage) []error {
+	errs := make([]error, len(pages))
+	fail := func(err error) []error {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	for i, p := range pages {
+		if _, err := tx.ExecContext(ctx, `SAVEPOINT page`); err != nil {
+			return fail(err)
+		}
+		if errs[i] = s.savePage(ctx, tx, p); errs[i] != nil {
+			if _, err := tx.ExecContext(ctx, `ROLLBACK TO page`); err != nil {
+				return fail(err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `RELEASE page`); err != nil {
+			return fail(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+	return errs
+}
+
+func (s *SQLite) savePage(ctx context.Context, tx *sql.Tx, p models.ScrapedPage) error {
+	source := p.Source
+	if source == "" {
+		source = models.SourceWeb
+	}
+	tags, err := jsonText(p.Tags)
+	if err != nil {
+		return err
+	}
+	opengraph, err := jsonText(p.OpenGraph)
+	if err != nil {
+		return err
+	}
+	breadcrumbs, err := jsonText(p.Breadcrumbs)
+	if err != nil {
+		return err
+	}
+	host, _ := urlDomain(p.URL)
+	var pageID int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO pages (url, title, crawled_at, source, tags, votes,
+			description, opengraph, breadcrumbs, last_updated, deprecated, quality, private, source_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+			COALESCE(?, (SELECT s.id FROM sources s, json_each(s.domains) d WHERE d.value = ? ORDER BY s.id LIMIT 1)))
+		ON CONFLICT (url)
+		DO UPDATE SET title = excluded.title, crawled_at = excluded.crawled_at,
+			source = excluded.source, tags = excluded.tags, votes = excluded.votes,
+			description = excluded.description, opengraph = excluded.opengraph,
+			breadcrumbs = excluded.breadcrumbs, last_updated = excluded.last_updated,
+			deprecated = excluded.deprecated, quality = excluded.quality,
+			private = excluded.private, source_id = excluded.source_id
+		RETURNING id
+	`, p.URL, p.Title, millis(time.Now()), source, tags, p.Votes,
+		p.Description, opengraph, breadcrumbs, nullString(p.LastUpdated), p.Deprecated, p.Quality, p.Private,
+		nullInt64(p.SourceID), host).Scan(&pageID)
+	if err != nil {
+		return fmt.Errorf("failed to save page: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM sections WHERE page_id = ?`, pageID)
+	if err != nil {
+		return fmt.Errorf("failed to delete old section: %v", err)
+	}
+	for i, section := range p.Sections {
+		data, err := sectionData(section)
+		if err != nil {
+			return fmt.Errorf("failed to encode section %v: %v", i, err)
+		}
+		var text any
+		if data != nil {
+			text = string(data)
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO sections (page_id, section_type, content, language, sort_order, data)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, pageID, section.Type, section.Content, section.Language, i, text)
+		if err != nil {
+			return fmt.Errorf("failed to save section %v with error %v", i, err)
+		}
+	}
+
+	if err := indexPage(ctx, tx, pageID, p); err != nil {
+		return fmt.Errorf("failed to index page text: %v", err)
+	}
+
+	version, err := s.saveVersion(ctx, tx, pageID, p)
+	if err != nil {
+		return fmt.Errorf("failed to save page version: %v", err)
+	}
+	if version > 0 {
+		if err := s.addWatchEvents(ctx, tx, pageID, p, version); err != nil {
+			return fmt.Errorf("failed to match watches: %v", err)
+		}
+	}
+	return nil
+}
+
+// indexPage replaces the page's row in pages_fts, with code and prose in
+// separate columns so they can be weighed apart.
+func indexPage(ctx context.Context, tx *sql.Tx, pageID int64, p models.ScrapedPage) error {
+	var code, body strings.Builder
+	for _, section := range p.Sections {
+		text := &body
+		if section.Type == "code" {
+			text = &code
+		}
+		if text.Len() < maxIndexText {
+			text.WriteString(section.Content)
+			text.WriteString(" ")
+		}
+	}
+	_, err := tx.ExecContext(ctx, `DELETE FROM pages_fts WHERE rowid = ?`, pageID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO pages_fts (rowid, title, description, code, body) VALUES (?, ?, ?, ?, ?)
+	`, pageID, p.Title, p.Description, capText(code.String(), maxIndexText), capText(body.String(), maxIndexText))
+	return err
+}
+
+func capText(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
+
+// ftsQuery turns a search into an fts5 query matching pages with every
+// word. Each word is quoted, so punctuation and fts5 operators in the
+// search are taken literally.
+func ftsQuery(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		if strings.IndexFunc(word, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) < 0 {
+			continue
+		}
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// GetPage loads a page and all of its sections, nil if the url is unknown.
+func (s *SQLite) GetPage(ctx context.Context, url string) (*models.ScrapedPage, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+sqlitePageColumns+` FROM pages p WHERE p.url = ?`, url)
+	pageID, page, err := scanSQLitePage(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sections, err := s.loadSections(ctx, []int64{pageID})
+	if err != nil {
+		return nil, err
+	}
+	page.Sections = sections[pageID]
+	if page.Sections == nil {
+		page.Sections = []models.PageSection{}
+	}
+	return &page, nil
+}
+
+// IteratePages calls processor with every page matching filter, in id
+// order, reading them in keyset batches like DB.IteratePages.
+func (s *SQLite) IteratePages(ctx context.Context, filter PageFilter, processor func(models.ScrapedPage) error) error {
+	size := filter.BatchSize
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	var after int64
+	for {
+		ids, pages, err := s.pageBatch(ctx, filter, after, size)
+		if err != nil {
+			return err
+		}
+		for _, p := range pages {
+			if err := processor(p); err != nil {
+				return err
+			}
+		}
+		if len(pages) < size {
+			return nil
+		}
+		after = ids[len(ids)-1]
+	}
+}
+
+func (s *SQLite) pageBatch(ctx context.Context, filter PageFilter, after int64, limit int) ([]int64, []models.ScrapedPage, error) {
+	where, args := filter.sqliteWhere()
+	args = append(append([]any{after}, args...), limit)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+sqlitePageColumns+`
+		FROM pages p
+		WHERE p.id > ? AND `+where+`
+		ORDER BY p.id
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	var pages []models.ScrapedPage
+	for rows.Next() {
+		id, page, err := scanSQLitePage(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+		pages = append(pages, page)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	rows.Close()
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+
+	sections, err := s.loadSections(ctx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, id := range ids {
+		pages[i].Sections = sections[id]
+		if pages[i].Sections == nil {
+			pages[i].Sections = []models.PageSection{}
+		}
+	}
+	return ids, pages, nil
+}
+
+func (s *SQLite) loadSections(ctx context.Context, pageIDs []int64) (map[int64][]models.PageSection, error) {
+	args := make([]any, len(pageIDs))
+	for i, id := range pageIDs {
+		args[i] = id
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT page_id, COALESCE(section_type, ''), COALESCE(content, ''), COALESCE(language, ''), data
+		FROM sections WHERE page_id IN (`+placeholders(len(pageIDs))+`)
+		ORDER BY page_id, sort_order
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sections := map[int64][]models.PageSection{}
+	for rows.Next() {
+		var pageID int64
+		var section models.PageSection
+		var data []byte
+		if err := rows.Scan(&pageID, &section.Type, &section.Content, &section.Language, &data); err != nil {
+			return nil, err
+		}
+		if err := decodeSectionData(&section, data); err != nil {
+			return nil, err
+		}
+		sections[pageID] = append(sections[pageID], section)
+	}
+	return sections, rows.Err()
+}
+
+// SearchPages finds the pages matching every word of query with fts5, best
+// first. Ranking follows DB.SearchPages: bm25, with the title weighed most,
+// scaled by log10(2 + quality) and deprecated pages demoted. Each page has a
+// single section, a snippet of its text around the matches.
+func (s *SQLite) SearchPages(ctx context.Context, query string, filter PageFilter, limit int) ([]models.ScrapedPage, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, nil
+	}
+	where, args := filter.sqliteWhere()
+	args = append(append([]any{match}, args...), limit)
+	// bm25 is negative, better matches lower, so boosts multiply it
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+sqlitePageColumns+`, snippet(pages_fts, 3, '', '', '…', 35)
+		FROM pages_fts
+		JOIN pages p ON p.id = pages_fts.rowid
+		WHERE pages_fts MATCH ? AND `+where+`
+		ORDER BY bm25(pages_fts, 10.0, 5.0, 5.0, 1.0) * log10(2 + COALESCE(p.quality, 0.5))
+			* CASE WHEN COALESCE(p.deprecated, '') = '' THEN 1 ELSE 0.3 END
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pages []models.ScrapedPage
+	for rows.Next() {
+		var snippet string
+		_, page, err := scanSQLitePage(rows, &snippet)
+		if err != nil {
+			return nil, err
+		}
+		page.Sections = []models.PageSection{{Content: strings.TrimSpace(snippet)}}
+		pages = append(pages, page)
+	}
+	return pages, rows.Err()
+}
+
+// saveVersion snapshots the page if its content changed, see
+// DB.saveVersion.
+func (s *SQLite) saveVersion(ctx context.Context, tx *sql.Tx, pageID int64, p models.ScrapedPage) (int, error) {
+	hash, err := contentHash(p)
+	if err != nil {
+		return 0, err
+	}
+
+	var latest int
+	var latestHash string
+	err = tx.QueryRowContext(ctx, `
+		SELECT version, hash FROM page_versions
+		WHERE page_id = ? ORDER BY version DESC LIMIT 1
+	`, pageID).Scan(&latest, &latestHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	if latestHash == hash {
+		return 0, nil
+	}
+
+	snapshot, err := json.Marshal(p)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO page_versions (page_id, version, title, hash, snapshot, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, pageID, latest+1, p.Title, hash, string(snapshot), millis(time.Now()))
+	if err != nil {
+		return 0, err
+	}
+
+	keep := s.KeepVersions
+	if keep <= 0 {
+		keep = DefaultKeepVersions
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM page_versions WHERE page_id = ? AND version <= ?`, pageID, latest+1-keep)
+	return latest + 1, err
+}
+
+// ListVersions returns the versions kept for a url, newest first, without
+// their snapshots.
+func (s *SQLite) ListVersions(ctx context.Context, url string) ([]models.PageVersion, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT v.version, v.created_at, COALESCE(v.title, ''), v.hash
+		FROM page_versions v
+		JOIN pages p ON p.id = v.page_id
+		WHERE p.url = ?
+		ORDER BY v.version DESC
+	`, url)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []models.PageVersion
+	for rows.Next() {
+		var v models.PageVersion
+		var createdAt int64
+		if err := rows.Scan(&v.Version, &createdAt, &v.Title, &v.Hash); err != nil {
+			return nil, err
+		}
+		v.CreatedAt = fromMillis(createdAt)
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// GetVersion loads one version of a url with its snapshot, the latest when
+// version is 0. It returns nil if there is no such version.
+func (s *SQLite) GetVersion(ctx context.Context, url string, version int) (*models.PageVersion, error) {
+	v := &models.PageVersion{}
+	var createdAt int64
+	var snapshot string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT v.version, v.created_at, COALESCE(v.title, ''), v.hash, v.snapshot
+		FROM page_versions v
+		JOIN pages p ON p.id = v.page_id
+		WHERE p.url = ? AND (? = 0 OR v.version = ?)
+		ORDER BY v.version DESC
+		LIMIT 1
+	`, url, version, version).Scan(&v.Version, &createdAt, &v.Title, &v.Hash, &snapshot)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	v.CreatedAt = fromMillis(createdAt)
+	v.Page = &models.ScrapedPage{}
+	if err := json.Unmarshal([]byte(snapshot), v.Page); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"oss/internal/models"
+)
+
+// addWatchEvents records events for the watches a newly saved version
+// triggers, in the page's transaction, see queueWatchEvents.
+// The page is already in pages_fts, so query watches are matched against
+// its row there.
+func (s *SQLite) addWatchEvents(ctx context.Context, tx *sql.Tx, pageID int64, p models.ScrapedPage, version int) error {
+	now := millis(time.Now())
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO watch_events (watch_id, url, title, version, message, created_at, next_attempt_at)
+		SELECT id, ?1, ?2, ?3, CASE WHEN ?3 = 1 THEN 'New page' ELSE 'Page changed' END, ?4, ?4
+		FROM watches
+		WHERE kind = 'page' AND target = ?1
+	`, p.URL, p.Title, version, now)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO watch_events (watch_id, url, title, version, message, created_at, next_attempt_at)
+		SELECT DISTINCT w.id, ?1, ?2, ?3, 'Documentation of ' || w.target || ' changed', ?4, ?4
+		FROM watches w
+		JOIN symbols s ON lower(s.name) = lower(w.target)
+			OR substr(lower(s.name), -(length(w.target) + 1)) = '.' || lower(w.target)
+		WHERE w.kind = 'symbol'
+			AND (CASE WHEN instr(s.url, '#') > 0 THEN substr(s.url, 1, instr(s.url, '#') - 1) ELSE s.url END) = ?1
+	`, p.URL, p.Title, version, now)
+	if err != nil {
+		return err
+	}
+
+	if version != 1 {
+		return nil
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT id, target FROM watches WHERE kind = 'query'`)
+	if err != nil {
+		return err
+	}
+	var matches []int64
+	var targets []string
+	for rows.Next() {
+		var id int64
+		var target string
+		if err := rows.Scan(&id, &target); err != nil {
+			rows.Close()
+			return err
+		}
+		matches = append(matches, id)
+		targets = append(targets, target)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i, id := range matches {
+		match := ftsQuery(targets[i])
+		if match == "" {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO watch_events (watch_id, url, title, version, message, created_at, next_attempt_at)
+			SELECT ?1, ?2, ?3, ?4, 'New page matching "' || ?5 || '"', ?6, ?6
+			WHERE EXISTS (SELECT 1 FROM pages_fts WHERE pages_fts MATCH ?7 AND rowid = ?8)
+		`, id, p.URL, p.Title, version, targets[i], now, match, pageID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateWatch stores a watch and sets its id and creation time.
+func (s *SQLite) CreateWatch(ctx context.Context, w *models.Watch) error {
+	now := millis(time.Now())
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO watches (user_id, kind, target, webhook_url, secret, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, w.User, w.Kind, w.Target, w.WebhookURL, w.Secret, now).Scan(&w.ID)
+	if err != nil {
+		return err
+	}
+	w.CreatedAt = fromMillis(now)
+	return nil
+}
+
+// ListWatches returns a user's watches without their secrets.
+func (s *SQLite) ListWatches(ctx context.Context, user string) ([]models.Watch, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, kind, target, COALESCE(webhook_url, ''), created_at
+		FROM watches WHERE user_id = ?
+		ORDER BY id
+	`, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watches := []models.Watch{}
+	for rows.Next() {
+		var w models.Watch
+		var createdAt int64
+		if err := rows.Scan(&w.ID, &w.User, &w.Kind, &w.Target, &w.WebhookURL, &createdAt); err != nil {
+			return nil, err
+		}
+		w.CreatedAt = fromMillis(createdAt)
+		watches = append(watches, w)
+	}
+	return watches, rows.Err()
+}
+
+// DeleteWatch removes a user's watch and its events, false if the user has
+// no such watch.
+func (s *SQLite) DeleteWatch(ctx context.Context, id int64, user string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM watches WHERE id = ? AND user_id = ?`, id, user)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func scanSQLiteWatchEvent(row rowScanner, e *models.WatchEvent, extra ...any) error {
+	var createdAt int64
+	dest := append([]any{&e.ID, &e.WatchID, &e.Kind, &e.Target, &e.URL, &e.Title, &e.Version, &e.Message, &createdAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+	e.CreatedAt = fromMillis(createdAt)
+	return nil
+}
+
+// Feed returns a user's latest events, newest first. With since it returns
+// the oldest events after that event id instead, oldest first, so a poller
+// following the last id it saw doesn't skip events.
+func (s *SQLite) Feed(ctx context.Context, user string, since int64, limit int) ([]models.WatchEvent, error) {
+	order := "DESC"
+	if since > 0 {
+		order = "ASC"
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+watchEventColumns+`
+		FROM watch_events e
+		JOIN watches w ON w.id = e.watch_id
+		WHERE w.user_id = ? AND e.id > ?
+		ORDER BY e.id `+order+`
+		LIMIT ?
+	`, user, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.WatchEvent{}
+	for rows.Next() {
+		var e models.WatchEvent
+		if err := scanSQLiteWatchEvent(rows, &e); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// ClaimDeliveries picks up to limit events due for webhook delivery and
+// holds them back from other claims for a minute.
+func (s *SQLite) ClaimDeliveries(ctx context.Context, maxAttempts, limit int) ([]models.WatchDelivery, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+watchEventColumns+`, w.webhook_url, COALESCE(w.secret, ''), e.attempts + 1
+		FROM watch_events e
+		JOIN watches w ON w.id = e.watch_id
+		WHERE e.delivered_at IS NULL AND COALESCE(w.webhook_url, '') <> ''
+			AND e.next_attempt_at <= ? AND e.attempts < ?
+		ORDER BY e.id
+		LIMIT ?
+	`, millis(now), maxAttempts, limit)
+	if err != nil {
+		return nil, err
+	}
+	var deliveries []models.WatchDelivery
+	for rows.Next() {
+		var d models.WatchDelivery
+		if err := scanSQLiteWatchEvent(rows, &d.Event, &d.WebhookURL, &d.Secret, &d.Attempts); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, d := range deliveries {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE watch_events SET attempts = attempts + 1, next_attempt_at = ? WHERE id = ?
+		`, millis(now.Add(time.Minute)), d.Event.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return deliveries, tx.Commit()
+}
+
+func (s *SQLite) MarkDelivered(ctx context.Context, eventID int64) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE watch_events SET delivered_at = ?, last_error = NULL WHERE id = ?
+	`, millis(time.Now()), eventID)
+	return err
+}
+
+// MarkFailed records a failed delivery, to be retried after retryIn.
+func (s *SQLite) MarkFailed(ctx context.Context, eventID int64, reason string, retryIn time.Duration) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE watch_events SET last_error = ?, next_attempt_at = ? WHERE id = ?
+	`, reason, millis(time.Now().Add(retryIn)), eventID)
+	return err
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"oss/internal/models"
+)
+
+// Store is the storage API. DB implements it on postgres and SQLite on a
+// local file, for running everything on one machine without a database
+// server. Open picks one by the database url.
+type Store interface {
+	// Dialect is "postgres" or "sqlite"
+	Dialect() string
+	Ping(ctx context.Context) error
+	Close()
+	// SetKeepVersions caps the snapshots kept per page, DefaultKeepVersions
+	// when zero
+	SetKeepVersions(n int)
+
+	CheckSchema(ctx context.Context) error
+	Migrate(ctx context.Context, target int) ([]Migration, error)
+	Rollback(ctx context.Context, steps int) ([]Migration, error)
+	MigrationStatus(ctx context.Context) ([]MigrationStatus, error)
+
+	SavePage(ctx context.Context, p models.ScrapedPage) error
+	// SavePages saves a batch of pages and returns why each failed, nil for
+	// those saved
+	SavePages(ctx context.Context, pages []models.ScrapedPage) []error
+	GetPage(ctx context.Context, url string) (*models.ScrapedPage, error)
+	IteratePages(ctx context.Context, filter PageFilter, processor func(models.ScrapedPage) error) error
+	SearchPages(ctx context.Context, query string, filter PageFilter, limit int) ([]models.ScrapedPage, error)
+	ListVersions(ctx context.Context, url string) ([]models.PageVersion, error)
+	GetVersion(ctx context.Context, url string, version int) (*models.PageVersion, error)
+
+	SaveSymbols(ctx context.Context, symbols []models.Symbol) error
+	LookupSymbols(ctx context.Context, name string, limit int) ([]models.Symbol, error)
+
+	CreateSource(ctx context.Context, s *models.Source) error
+	UpdateSource(ctx context.Context, s *models.Source) (*models.Source, error)
+	SetSourceEnabled(ctx context.Context, id int64, owner string, enabled bool) (bool, error)
+	GetSource(ctx context.Context, id int64) (*models.Source, error)
+	GetSourceByName(ctx context.Context, name string) (*models.Source, error)
+	ListSources(ctx context.Context, enabledOnly bool) ([]models.Source, error)
+
+	SaveCrawlRun(ctx context.Context, run *models.CrawlRun) error
+	ListCrawlRuns(ctx context.Context, source string, limit int) ([]models.CrawlRun, error)
+	GetCrawlRun(ctx context.Context, id int64) (*models.CrawlRun, error)
+
+	SeedFrontier(ctx context.Context, domains, urls []string, delay time.Duration, recrawl bool) error
+	Enqueue(ctx context.Context, urls []string, depth int) error
+	RequestRecrawl(ctx context.Context, urls []string, priority int) ([]string, error)
+	RequestDomainRecrawl(ctx context.Context, domain string, priority int) (int, error)
+	Claim(ctx context.Context, worker string, lease time.Duration) (*models.FrontierURL, error)
+	Complete(ctx context.Context, id int64, worker string) error
+	Fail(ctx context.Context, id int64, worker, reason string, maxAttempts int) error
+	Outstanding(ctx context.Context) (int, error)
+	FrontierCounts(ctx context.Context) (map[string]int, error)
+	Heartbeat(ctx context.Context, w models.Worker, lease time.Duration) error
+	Release(ctx context.Context, worker string) error
+	ListWorkers(ctx context.Context, staleAfter time.Duration) ([]models.Worker, error)
+
+	CreateWatch(ctx context.Context, w *models.Watch) error
+	ListWatches(ctx context.Context, user string) ([]models.Watch, error)
+	DeleteWatch(ctx context.Context, id int64, user string) (bool, error)
+	Feed(ctx context.Context, user string, since int64, limit int) ([]models.WatchEvent, error)
+	ClaimDeliveries(ctx context.Context, maxAttempts, limit int) ([]models.WatchDelivery, error)
+	MarkDelivered(ctx context.Context, eventID int64) error
+	MarkFailed(ctx context.Context, eventID int64, reason string, retryIn time.Duration) error
+
+	Checkpoint(ctx context.Context, name string) (time.Time, error)
+	SaveCheckpoint(ctx context.Context, name string, at time.Time) error
+}
+
+var (
+	_ Store = (*DB)(nil)
+	_ Store = (*SQLite)(nil)
+)
+
+// Open connects to the database a url names: postgres://... or
+// postgresql://... for postgres, sqlite:path for a SQLite file, e.g.
+// sqlite:search.db or sqlite:///var/lib/search/search.db.
+func Open(databaseURL string) (Store, error) {
+	scheme, rest, _ := strings.Cut(databaseURL, ":")
+	switch strings.ToLower(scheme) {
+	case "postgres", "postgresql":
+		return NewDB(databaseURL)
+	case "sqlite", "sqlite3":
+		path := strings.TrimPrefix(rest, "//")
+		if path == "" {
+			return nil, fmt.Errorf("database url %q has no file path", databaseURL)
+		}
+		return NewSQLite(path)
+	}
+	return nil, fmt.Errorf("unsupported database url scheme %q, use postgres:// or sqlite:", scheme)
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"oss/internal/models"
+)
+
+// SaveSymbols upserts a batch of symbols in one transaction.
+func (db *DB) SaveSymbols(ctx context.Context, symbols []models.Symbol) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		INSERT INTO symbols (name, domain, role, url, display_name, project, version, priority)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (name, domain, role, url)
+		DO UPDATE SET display_name = EXCLUDED.display_name, project = EXCLUDED.project,
+			version = EXCLUDED.version, priority = EXCLUDED.priority
+	`
+	for _, s := range symbols {
+		_, err = tx.Exec(ctx, query,
+			s.Name,
+			s.Domain,
+			s.Role,
+			s.URL,
+			s.DisplayName,
+			s.Project,
+			s.Version,
+			s.Priority)
+		if err != nil {
+			return fmt.Errorf("failed to save symbol %s: %v", s.Name, err)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// LookupSymbols finds symbols named name, or whose dotted path ends in name,
+// so "Tensor.view" finds "torch.Tensor.view". Exact matches come first.
+func (db *DB) LookupSymbols(ctx context.Context, name string, limit int) ([]models.Symbol, error) {
+	query := `
+		SELECT name, domain, role, url, COALESCE(display_name, ''), COALESCE(project, ''),
+			COALESCE(version, ''), COALESCE(priority, 1)
+		FROM symbols
+		WHERE lower(name) = lower($1) OR lower(name) LIKE '%.' || lower($2)
+		ORDER BY lower(name) = lower($1) DESC, priority, length(name), name
+		LIMIT $3
+	`
+	rows, err := db.Pool.Query(ctx, query, name, escapeLike(name), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	symbols := []models.Symbol{}
+	for rows.Next() {
+		var s models.Symbol
+		err := rows.Scan(&s.Name, &s.Domain, &s.Role, &s.URL, &s.DisplayName, &s.Project, &s.Version, &s.Priority)
+		if err != nil {
+			return nil, err
+		}
+		symbols = append(symbols, s)
+	}
+	return symbols, rows.Err()
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
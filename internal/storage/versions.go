@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"oss/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultKeepVersions is how many versions of a page are kept when
+// DB.KeepVersions isn't set.
+const DefaultKeepVersions = 20
+
+// contentHash identifies a page's content, the title and sections. Crawl
+// times and scores don't count as changes.
+func contentHash(p models.ScrapedPage) (string, error) {
+	data, err := json.Marshal(struct {
+		Title    string               `json:"title"`
+		Sections []models.PageSection `json:"sections"`
+	}{p.Title, p.Sections})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// saveVersion snapshots the page if its content differs from the latest
+// version, then drops versions beyond the retention limit. It returns the
+// new version number, or 0 when the page didn't change.
+func (db *DB) saveVersion(ctx context.Context, tx pgx.Tx, pageID int, p models.ScrapedPage) (int, error) {
+	hash, err := contentHash(p)
+	if err != nil {
+		return 0, err
+	}
+
+	var latest int
+	var latestHash string
+	err = tx.QueryRow(ctx, `
+		SELECT version, hash FROM page_versions
+		WHERE page_id = $1 ORDER BY version DESC LIMIT 1
+	`, pageID).Scan(&latest, &latestHash)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+	if latestHash == hash {
+		return 0, nil
+	}
+
+	snapshot, err := json.Marshal(p)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO page_versions (page_id, version, title, hash, snapshot, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, pageID, latest+1, p.Title, hash, snapshot, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	keep := db.KeepVersions
+	if keep <= 0 {
+		keep = DefaultKeepVersions
+	}
+	_, err = tx.Exec(ctx, `DELETE FROM page_versions WHERE page_id = $1 AND version <= $2`, pageID, latest+1-keep)
+	return latest + 1, err
+}
+
+// ListVersions returns the versions kept for a url, newest first, without
+// their snapshots. It returns nil if the url is unknown.
+func (db *DB) ListVersions(ctx context.Context, url string) ([]models.PageVersion, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT v.version, v.created_at, COALESCE(v.title, ''), v.hash
+		FROM page_versions v
+		JOIN pages p ON p.id = v.page_id
+		WHERE p.url = $1
+		ORDER BY v.version DESC
+	`, url)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []models.PageVersion
+	for rows.Next() {
+		var v models.PageVersion
+		if err := rows.Scan(&v.Version, &v.CreatedAt, &v.Title, &v.Hash); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// GetVersion loads one version of a url with its snapshot, the latest when
+// version is 0. It returns nil if there is no such version.
+func (db *DB) GetVersion(ctx context.Context, url string, version int) (*models.PageVersion, error) {
+	v := &models.PageVersion{}
+	var snapshot []byte
+	err := db.Pool.QueryRow(ctx, `
+		SELECT v.version, v.created_at, COALESCE(v.title, ''), v.hash, v.snapshot
+		FROM page_versions v
+		JOIN pages p ON p.id = v.page_id
+		WHERE p.url = $1 AND ($2 = 0 OR v.version = $2)
+		ORDER BY v.version DESC
+		LIMIT 1
+	`, url, version).Scan(&v.Version, &v.CreatedAt, &v.Title, &v.Hash, &snapshot)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	v.Page = &models.ScrapedPage{}
+	if err := json.Unmarshal(snapshot, v.Page); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
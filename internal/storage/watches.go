@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"oss/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// queueWatchEvents queues the statements recording events for the watches a
+// newly saved version triggers. They are sent in the page's transaction, so
+// an event exists exactly when the version does, after the page's
+// search_vector is updated. The first version of a page saved before
+// versioning existed is not a new page and triggers nothing, callers skip
+// those.
+func queueWatchEvents(b *pgx.Batch, p models.ScrapedPage, version int) {
+	b.Queue(`
+		INSERT INTO watch_events (watch_id, url, title, version, message)
+		SELECT id, $1, $2, $3, CASE WHEN $3 = 1 THEN 'New page' ELSE 'Page changed' END
+		FROM watches
+		WHERE kind = 'page' AND target = $1
+	`, p.URL, p.Title, version)
+
+	b.Queue(`
+		INSERT INTO watch_events (watch_id, url, title, version, message)
+		SELECT DISTINCT w.id, $1, $2, $3, 'Documentation of ' || w.target || ' changed'
+		FROM watches w
+		JOIN symbols s ON lower(s.name) = lower(w.target)
+			OR right(lower(s.name), length(w.target) + 1) = '.' || lower(w.target)
+		WHERE w.kind = 'symbol' AND split_part(s.url, '#', 1) = $1
+	`, p.URL, p.Title, version)
+
+	if version != 1 {
+		return
+	}
+	b.Queue(`
+		INSERT INTO watch_events (watch_id, url, title, version, message)
+		SELECT w.id, $1, $2, $3, 'New page matching "' || w.target || '"'
+		FROM watches w
+		JOIN pages p ON p.url = $1
+		WHERE w.kind = 'query' AND p.search_vector @@ plainto_tsquery('english', w.target)
+	`, p.URL, p.Title, version)
+}
+
+// CreateWatch stores a watch and sets its id and creation time.
+func (db *DB) CreateWatch(ctx context.Context, w *models.Watch) error {
+	return db.Pool.QueryRow(ctx, `
+		INSERT INTO watches (user_id, kind, target, webhook_url, secret)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, w.User, w.Kind, w.Target, w.WebhookURL, w.Secret).Scan(&w.ID, &w.CreatedAt)
+}
+
+// ListWatches returns a user's watches without their secrets.
+func (db *DB) ListWatches(ctx context.Context, user string) ([]models.Watch, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, user_id, kind, target, COALESCE(webhook_url, ''), created_at
+		FROM watches WHERE user_id = $1
+		ORDER BY id
+	`, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watches := []models.Watch{}
+	for rows.Next() {
+		var w models.Watch
+		if err := rows.Scan(&w.ID, &w.User, &w.Kind, &w.Target, &w.WebhookURL, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		watches = append(watches, w)
+	}
+	return watches, rows.Err()
+}
+
+// DeleteWatch removes a user's watch and its events, false if the user has
+// no such watch.
+func (db *DB) DeleteWatch(ctx context.Context, id int64, user string) (bool, error) {
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM watches WHERE id = $1 AND user_id = $2`, id, user)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+const watchEventColumns = `e.id, e.watch_id, w.kind, w.target, e.url, COALESCE(e.title, ''), e.version,
+	e.message, e.created_at`
+
+// Feed returns a user's latest events, newest first. With since it returns
+// the oldest events after that event id instead, oldest first, so a poller
+// following the last id it saw doesn't skip events.
+func (db *DB) Feed(ctx context.Context, user string, since int64, limit int) ([]models.WatchEvent, error) {
+	order := "DESC"
+	if since > 0 {
+		order = "ASC"
+	}
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+watchEventColumns+`
+		FROM watch_events e
+		JOIN watches w ON w.id = e.watch_id
+		WHERE w.user_id = $1 AND e.id > $2
+		ORDER BY e.id `+order+`
+		LIMIT $3
+	`, user, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.WatchEvent{}
+	for rows.Next() {
+		var e models.WatchEvent
+		err := rows.Scan(&e.ID, &e.WatchID, &e.Kind, &e.Target, &e.URL, &e.Title, &e.Version, &e.Message, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// ClaimDeliveries picks up to limit events due for webhook delivery. Claimed
+// events aren't handed out again for a minute, so several servers can
+// deliver side by side.
+func (db *DB) ClaimDeliveries(ctx context.Context, maxAttempts, limit int) ([]models.WatchDelivery, error) {
+	rows, err := db.Pool.Query(ctx, `
+		UPDATE watch_events e
+		SET attempts = e.attempts + 1, next_attempt_at = now() + interval '1 minute'
+		FROM watches w
+		WHERE w.id = e.watch_id AND e.id IN (
+			SELECT e2.id
+			FROM watch_events e2
+			JOIN watches w2 ON w2.id = e2.watch_id
+			WHERE e2.delivered_at IS NULL AND COALESCE(w2.webhook_url, '') <> ''
+				AND e2.next_attempt_at <= now() AND e2.attempts < $1
+			ORDER BY e2.id
+			LIMIT $2
+			FOR UPDATE OF e2 SKIP LOCKED
+		)
+		RETURNING `+watchEventColumns+`, w.webhook_url, COALESCE(w.secret, ''), e.attempts
+	`, maxAttempts, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WatchDelivery
+	for rows.Next() {
+		var d models.WatchDelivery
+		e := &d.Event
+		err := rows.Scan(&e.ID, &e.WatchID, &e.Kind, &e.Target, &e.URL, &e.Title, &e.Version, &e.Message, &e.CreatedAt,
+			&d.WebhookURL, &d.Secret, &d.Attempts)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (db *DB) MarkDelivered(ctx context.Context, eventID int64) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE watch_events SET delivered_at = now(), last_error = NULL WHERE id = $1
+	`, eventID)
+	return err
+}
+
+// MarkFailed records a failed delivery, to be retried after retryIn.
+func (db *DB) MarkFailed(ctx context.Context, eventID int64, reason string, retryIn time.Duration) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE watch_events SET last_error = $2, next_attempt_at = now() + make_interval(secs => $3)
+		WHERE id = $1
+	`, eventID, reason, retryIn.Seconds())
+	return err
+}
@@ -0,0 +1,142 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"oss/internal/models"
+	"oss/internal/storage"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the request body, keyed
+// with the watch secret, as "sha256=<hex>".
+const SignatureHeader = "X-Signature-256"
+
+// NewSecret returns a random secret for signing a watch's deliveries.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header value against the body, for receivers.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Notifier posts watch events to their webhooks. Events are claimed from
+// the database, so any number of servers can run one.
+type Notifier struct {
+	DB       storage.Store
+	Client   *http.Client
+	Interval time.Duration
+	// MaxAttempts gives up on an event after this many failed deliveries
+	MaxAttempts int
+}
+
+func NewNotifier(db storage.Store) *Notifier {
+	return &Notifier{
+		DB:          db,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		Interval:    10 * time.Second,
+		MaxAttempts: 8,
+	}
+}
+
+// Run delivers due events every Interval until ctx is cancelled.
+func (n *Notifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(n.Interval)
+	defer ticker.Stop()
+	for {
+		n.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (n *Notifier) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		deliveries, err := n.DB.ClaimDeliveries(ctx, n.MaxAttempts, 50)
+		if err != nil {
+			log.Printf("failed to claim watch events: %v\n", err)
+			return
+		}
+		if len(deliveries) == 0 {
+			return
+		}
+		for _, d := range deliveries {
+			if err := n.deliver(ctx, d); err != nil {
+				// back off exponentially, capped at a few hours
+				retryIn := time.Minute << min(d.Attempts, 8)
+				log.Printf("failed to deliver watch event %d to %s: %v\n", d.Event.ID, d.WebhookURL, err)
+				if err := n.DB.MarkFailed(ctx, d.Event.ID, err.Error(), retryIn); err != nil {
+					log.Printf("failed to record delivery failure: %v\n", err)
+				}
+				continue
+			}
+			if err := n.DB.MarkDelivered(ctx, d.Event.ID); err != nil {
+				log.Printf("failed to record delivery: %v\n", err)
+			}
+		}
+	}
+}
+
+func (n *Notifier) deliver(ctx context.Context, d models.WatchDelivery) error {
+	body, err := json.Marshal(d.Event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", strconv.FormatInt(d.Event.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(d.Secret, body))
+
+	res, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", res.Status)
+	}
+	return nil
+}
+
+// ValidKind reports whether kind is a watch kind.
+func ValidKind(kind string) bool {
+	switch kind {
+	case models.WatchPage, models.WatchSymbol, models.WatchQuery:
+		return true
+	}
+	return false
+}
+
+// ValidWebhook accepts http and https urls.
+func ValidWebhook(u string) bool {
+	return strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://")
+}